@@ -0,0 +1,75 @@
+package apierror
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// Error is an error meant for the API client. Handlers record it with
+// c.Error and the Errors middleware renders it as an RFC 7807 problem.
+type Error struct {
+	Status int
+	// Code identifies the error for programs, it doesn't change when the
+	// message is reworded.
+	Code    string
+	Message string
+	// Details is extra data about the error, rendered as is.
+	Details any
+	// Err is the cause of the error. It is logged, never sent to the client.
+	Err error
+}
+
+func New(status int, code, message string) *Error {
+	return &Error{Status: status, Code: code, Message: message}
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%s: %v", e.Message, e.Err)
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// WithDetails returns a copy of e carrying details.
+func (e *Error) WithDetails(details any) *Error {
+	c := *e
+	c.Details = details
+	return &c
+}
+
+// Wrap returns a copy of e caused by err.
+func (e *Error) Wrap(err error) *Error {
+	c := *e
+	c.Err = err
+	return &c
+}
+
+func BadRequest(code, message string) *Error {
+	return New(http.StatusBadRequest, code, message)
+}
+
+func Unauthorized(code, message string) *Error {
+	return New(http.StatusUnauthorized, code, message)
+}
+
+func Forbidden(code, message string) *Error {
+	return New(http.StatusForbidden, code, message)
+}
+
+func NotFound(code, message string) *Error {
+	return New(http.StatusNotFound, code, message)
+}
+
+func Conflict(code, message string) *Error {
+	return New(http.StatusConflict, code, message)
+}
+
+// Internal is a server side failure caused by err. Only message is shown to
+// the client.
+func Internal(message string, err error) *Error {
+	return &Error{Status: http.StatusInternalServerError, Code: "internal_error", Message: message, Err: err}
+}
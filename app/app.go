@@ -0,0 +1,197 @@
+package app
+
+import (
+	"context"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"io"
+	"log/slog"
+	"main/config"
+	"main/controllers"
+	"main/initializers"
+	"main/jobs"
+	"main/logging"
+	"main/migrations"
+	"main/ratelimit"
+	"main/storage"
+	"net/http"
+	"time"
+)
+
+// App owns everything the server runs on: the configuration, the database,
+// the storage backend and the services built on top of them.
+type App struct {
+	Config  *config.Config
+	DB      *gorm.DB
+	Storage storage.Storage
+	Signer  *storage.URLSigner
+	Handler *controllers.Handler
+	Jobs    *jobs.Runner
+	// RateLimits holds the buckets of the rate limiter.
+	RateLimits ratelimit.Store
+}
+
+// New connects to the database and storage described by cfg, checks that
+// the schema is fully migrated and wires the services together.
+func New(cfg *config.Config) (*App, error) {
+	db, err := OpenDB(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	store, signer, err := initializers.ConnectToStorage(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	limits, err := initializers.ConnectToRateLimitStore(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return Build(cfg, db, store, signer, limits), nil
+}
+
+// OpenDB connects to the database and checks that the schema is fully
+// migrated, for commands that need nothing else.
+func OpenDB(cfg *config.Config) (*gorm.DB, error) {
+	db, err := initializers.ConnectToDB(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	migrator, err := migrations.New(db)
+	if err != nil {
+		return nil, err
+	}
+	if err := migrator.Check(context.Background()); err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
+// Build wires the services together around connections that are already
+// open, tests use it with a throwaway database and storage.
+func Build(cfg *config.Config, db *gorm.DB, store storage.Storage, signer *storage.URLSigner, limits ratelimit.Store) *App {
+	return &App{
+		Config:  cfg,
+		DB:      db,
+		Storage: store,
+		Signer:  signer,
+		Handler: controllers.NewHandler(db, cfg, store, signer, limits),
+		Jobs:    jobs.NewRunner(db, store, cfg.Storage.ResumableDir),
+
+		RateLimits: limits,
+	}
+}
+
+// Serve runs the API server and the background jobs until ctx is cancelled,
+// then drains them: the readiness probe starts failing, in-flight requests
+// get up to the shutdown timeout to finish, job runs are cancelled, and the
+// database is closed.
+func (a *App) Serve(ctx context.Context) error {
+	server := &http.Server{
+		Addr:              ":" + a.Config.Port,
+		Handler:           a.Router(),
+		ReadHeaderTimeout: a.Config.Server.ReadHeaderTimeout,
+		ReadTimeout:       a.Config.Server.ReadTimeout,
+		WriteTimeout:      a.Config.Server.WriteTimeout,
+		IdleTimeout:       a.Config.Server.IdleTimeout,
+		ErrorLog:          logging.StdLogger(slog.LevelWarn),
+	}
+
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+	defer stopJobs()
+	a.StartJobs(jobsCtx)
+
+	// Metrics get a server of their own when they must not be reachable
+	// through the API port.
+	var metricsServer *http.Server
+	if a.Config.Metrics.Enabled && a.Config.Metrics.Addr != "" {
+		metricsServer = &http.Server{
+			Addr:              a.Config.Metrics.Addr,
+			Handler:           MetricsRoutes(a.Config),
+			ReadHeaderTimeout: a.Config.Server.ReadHeaderTimeout,
+			ErrorLog:          logging.StdLogger(slog.LevelWarn),
+		}
+	}
+
+	serveErr := make(chan error, 2)
+	go func() {
+		slog.Info("Listening", "addr", server.Addr)
+		serveErr <- server.ListenAndServe()
+	}()
+	if metricsServer != nil {
+		go func() {
+			slog.Info("Serving metrics", "addr", metricsServer.Addr)
+			serveErr <- metricsServer.ListenAndServe()
+		}()
+	}
+
+	select {
+	case err := <-serveErr:
+		server.Close()
+		if metricsServer != nil {
+			metricsServer.Close()
+		}
+		stopJobs()
+		a.Jobs.Wait()
+		a.Close()
+		return err
+	case <-ctx.Done():
+	}
+
+	slog.Info("Shutting down")
+	a.Handler.Drain()
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), a.Config.Server.ShutdownTimeout)
+	defer cancel()
+
+	err := server.Shutdown(shutdownCtx)
+	if err != nil {
+		slog.Error("Failed to drain requests", "error", err)
+	}
+	if metricsServer != nil {
+		metricsServer.Close()
+	}
+
+	stopJobs()
+	jobsDone := make(chan struct{})
+	go func() {
+		a.Jobs.Wait()
+		close(jobsDone)
+	}()
+	select {
+	case <-jobsDone:
+	case <-shutdownCtx.Done():
+		slog.Warn("Background jobs did not stop in time")
+	}
+
+	a.Close()
+	slog.Info("Shut down")
+	return err
+}
+
+// Close closes the database connections and those of the rate limit store.
+func (a *App) Close() {
+	if sqlDB, err := a.DB.DB(); err == nil {
+		sqlDB.Close()
+	}
+	if closer, ok := a.RateLimits.(io.Closer); ok {
+		closer.Close()
+	}
+}
+
+// Router returns the router serving the API.
+func (a *App) Router() *gin.Engine {
+	return Routes(a.Handler, a.Config, a.RateLimits)
+}
+
+// StartJobs starts the background jobs. They run until ctx is cancelled.
+func (a *App) StartJobs(ctx context.Context) {
+	a.Jobs.StartTrends(ctx, 5*time.Minute)
+	a.Jobs.StartMediaGC(ctx, time.Hour, 24*time.Hour)
+	a.Jobs.StartResumableGC(ctx, time.Hour)
+	a.Jobs.StartFileGC(ctx, 6*time.Hour, 24*time.Hour, a.Config.Storage.FileGCDryRun)
+	a.Jobs.StartCounterReconciler(ctx, 24*time.Hour)
+}
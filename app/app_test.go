@@ -0,0 +1,189 @@
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"main/initializers"
+	"main/metrics"
+	"main/ratelimit"
+	"main/testdb"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// newTestApp builds an App on an in-memory database and a temporary storage
+// directory.
+func newTestApp(t *testing.T) *App {
+	t.Helper()
+
+	cfg := testdb.Config()
+	cfg.Auth.Secret = "test secret"
+	cfg.Storage.Driver = "local"
+	cfg.Storage.Path = t.TempDir()
+	cfg.Storage.ResumableDir = t.TempDir()
+	cfg.Storage.URLSecret = cfg.Auth.Secret
+
+	store, signer, err := initializers.ConnectToStorage(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return Build(cfg, testdb.Open(t), store, signer, ratelimit.NewMemoryStore())
+}
+
+func multipartForm(t *testing.T, fields map[string]string) (*bytes.Buffer, string) {
+	t.Helper()
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	for name, value := range fields {
+		if err := form.WriteField(name, value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := form.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return &body, form.FormDataContentType()
+}
+
+func TestRoutesAuthAndTweets(t *testing.T) {
+	router := newTestApp(t).Router()
+	serve := func(req *http.Request) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// Without a token the request is refused with a problem.
+	w := serve(httptest.NewRequest(http.MethodGet, "/user", nil))
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("GET /user without a token: got %d, want 401", w.Code)
+	}
+	var problem struct {
+		Code string `json:"code"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &problem); err != nil || problem.Code != "missing_token" {
+		t.Fatalf("GET /user without a token: got %s, want a missing_token problem", w.Body)
+	}
+
+	body, contentType := multipartForm(t, map[string]string{
+		"UserName": "alice",
+		"Email":    "alice@example.com",
+		"Password": "Passw0rd!",
+	})
+	req := httptest.NewRequest(http.MethodPost, "/signup", body)
+	req.Header.Set("Content-Type", contentType)
+	if w := serve(req); w.Code != http.StatusOK {
+		t.Fatalf("signup: got %d: %s", w.Code, w.Body)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(`{"email":"alice@example.com","password":"Passw0rd!"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w = serve(req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("login: got %d: %s", w.Code, w.Body)
+	}
+	var tokens struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &tokens); err != nil || tokens.AccessToken == "" {
+		t.Fatalf("login: no access token in %s", w.Body)
+	}
+	authorized := func(req *http.Request) *http.Request {
+		req.Header.Set("Authorization", "Bearer "+tokens.AccessToken)
+		return req
+	}
+
+	if w := serve(authorized(httptest.NewRequest(http.MethodGet, "/user", nil))); w.Code != http.StatusOK {
+		t.Fatalf("GET /user: got %d: %s", w.Code, w.Body)
+	}
+
+	body, contentType = multipartForm(t, map[string]string{"title": "Hello", "body": "First tweet"})
+	req = authorized(httptest.NewRequest(http.MethodPost, "/create-tweet", body))
+	req.Header.Set("Content-Type", contentType)
+	w = serve(req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("create tweet: got %d: %s", w.Code, w.Body)
+	}
+	var created struct {
+		Tweet struct {
+			ID uint `json:"id"`
+		} `json:"tweet"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &created); err != nil || created.Tweet.ID == 0 {
+		t.Fatalf("create tweet: no tweet ID in %s", w.Body)
+	}
+	path := fmt.Sprintf("/tweet/%d", created.Tweet.ID)
+
+	w = serve(authorized(httptest.NewRequest(http.MethodGet, path, nil)))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "First tweet") {
+		t.Fatalf("GET %s: got %d: %s", path, w.Code, w.Body)
+	}
+
+	w = serve(authorized(httptest.NewRequest(http.MethodDelete, path, nil)))
+	if w.Code != http.StatusNoContent || w.Body.Len() != 0 {
+		t.Fatalf("DELETE %s: got %d: %s", path, w.Code, w.Body)
+	}
+
+	if w := serve(authorized(httptest.NewRequest(http.MethodGet, path, nil))); w.Code != http.StatusNotFound {
+		t.Fatalf("GET %s after deleting it: got %d, want 404", path, w.Code)
+	}
+}
+
+func TestMetricsRecordErrorStatuses(t *testing.T) {
+	router := newTestApp(t).Router()
+
+	tests := []struct {
+		method, path, route string
+		status              int
+	}{
+		{http.MethodGet, "/no/such/route", "unmatched", http.StatusNotFound},
+		{http.MethodGet, "/user", "/user", http.StatusUnauthorized},
+		{http.MethodPut, "/login", "unmatched", http.StatusMethodNotAllowed},
+	}
+	for _, test := range tests {
+		status := fmt.Sprint(test.status)
+		counter := metrics.HTTPRequests.WithLabelValues(test.method, test.route, status)
+		before := testutil.ToFloat64(counter)
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(test.method, test.path, nil))
+		if w.Code != test.status {
+			t.Fatalf("%s %s: got %d, want %d", test.method, test.path, w.Code, test.status)
+		}
+		if got := testutil.ToFloat64(counter) - before; got != 1 {
+			t.Errorf("%s %s: recorded %v requests with status %s, want 1", test.method, test.path, got, status)
+		}
+	}
+}
+
+func TestMetricsEndpointNeedsATokenOnTheAPIPort(t *testing.T) {
+	a := newTestApp(t)
+	get := func(token string) int {
+		req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		a.Router().ServeHTTP(w, req)
+		return w.Code
+	}
+
+	if code := get(""); code != http.StatusNotFound {
+		t.Fatalf("GET /metrics by default: got %d, want 404", code)
+	}
+
+	a.Config.Metrics.Enabled = true
+	a.Config.Metrics.Token = "scrape"
+	if code := get(""); code != http.StatusUnauthorized {
+		t.Fatalf("GET /metrics without the token: got %d, want 401", code)
+	}
+	if code := get("scrape"); code != http.StatusOK {
+		t.Fatalf("GET /metrics with the token: got %d, want 200", code)
+	}
+}
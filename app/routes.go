@@ -0,0 +1,131 @@
+package app
+
+import (
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+	"main/config"
+	"main/controllers"
+	"main/metrics"
+	"main/middlewares"
+	"main/ratelimit"
+	"net/http"
+)
+
+// Routes builds the router serving the API of h, rate limited with the
+// buckets in limits (nil for no limits). It doesn't touch anything global,
+// so tests can call it with a Handler of their own and drive it through
+// httptest.
+func Routes(h *controllers.Handler, cfg *config.Config, limits ratelimit.Store) *gin.Engine {
+	r := gin.New()
+	r.MaxMultipartMemory = cfg.Uploads.MaxFormMemory
+	// The proxies were checked by config.Validate.
+	_ = r.SetTrustedProxies(cfg.Server.TrustedProxies)
+	r.Use(otelgin.Middleware(cfg.Tracing.ServiceName, otelgin.WithFilter(traced)))
+	// Metrics goes before Errors, which writes the status of failed requests
+	// once the handlers have returned.
+	r.Use(middlewares.RequestID(), middlewares.AccessLog(), middlewares.Metrics(), middlewares.Errors(), middlewares.Recovery())
+	r.Use(middlewares.CORS(cfg.CORS))
+	r.Use(middlewares.BodyLimit(cfg.Uploads.MaxRequestSize))
+	r.HandleMethodNotAllowed = true
+	r.NoRoute(middlewares.NoRoute)
+	r.NoMethod(middlewares.NoMethod)
+
+	auth := middlewares.CheckAuth(h.Repos.Users, cfg.Auth.Secret)
+
+	if !cfg.RateLimit.Enabled {
+		limits = nil
+	}
+	limit := func(name string, policy config.RateLimitPolicy) gin.HandlerFunc {
+		return middlewares.RateLimit(limits, ratelimit.Policy{
+			Name: name, Limit: policy.Limit, Period: policy.Period, Burst: policy.Burst,
+		})
+	}
+	authLimit := limit("auth", cfg.RateLimit.Auth)
+	tweetsLimit := limit("tweets", cfg.RateLimit.Tweets)
+	socialLimit := limit("social", cfg.RateLimit.Social)
+	uploadsLimit := limit("uploads", cfg.RateLimit.Uploads)
+
+	// Probes for the orchestrator.
+	r.GET("/healthz", h.Healthz)
+	r.GET("/readyz", h.Readyz)
+
+	if cfg.Metrics.Enabled && cfg.Metrics.Addr == "" {
+		r.GET("/metrics", middlewares.MetricsToken(cfg.Metrics.Token), gin.WrapH(metrics.Handler()))
+	}
+
+	// Uploads are served through signed URLs instead of the Authorization
+	// header so they can be loaded by <img> and <video> tags.
+	r.GET("/uploads/*filepath", h.ServeUpload)
+	//Users endpoints
+	r.POST("/signup", authLimit, h.SignUp)
+	r.POST("/login", authLimit, h.Login)
+	r.POST("/refresh", authLimit, h.RefreshToken)
+	r.GET("/user", auth, h.UserProfile)
+	r.PATCH("/user", auth, h.UserUpdate)
+	r.GET("/user/storage", auth, h.UserStorage)
+	r.POST("/change-password", auth, h.ChangePassword)
+	r.GET("/", auth, func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"message": "Access granted to protected route"})
+	})
+
+	// Tweets endpoint
+	r.GET("/tweet/:id", auth, h.TweetRetrieve)
+	r.PATCH("/tweet/:id", auth, tweetsLimit, h.TweetUpdate)
+	r.DELETE("/tweet/:id", auth, tweetsLimit, h.TweetDelete)
+	r.GET("/tweet", auth, h.TweetList)
+	r.POST("/create-tweet", auth, tweetsLimit, h.CreateTweet)
+
+	// Media endpoint
+	r.POST("/media", auth, uploadsLimit, h.UploadMedia)
+
+	// Resumable upload (tus) endpoint
+	r.OPTIONS("/resumable", h.ResumableOptions)
+	r.POST("/resumable", auth, uploadsLimit, h.CreateResumableUpload)
+	r.HEAD("/resumable/:id", auth, h.ResumableStatus)
+	r.PATCH("/resumable/:id", auth, h.AppendResumableChunk)
+	r.DELETE("/resumable/:id", auth, h.DeleteResumableUpload)
+	r.POST("/resumable/:id/finalize", auth, h.FinalizeResumableUpload)
+
+	// Followers endpoint
+	r.POST("/follow/:id", auth, socialLimit, h.FollowUser)
+	r.POST("/unfollow/:id", auth, socialLimit, h.UnFollow)
+	r.GET("/followers", auth, h.ListFollowers)
+	r.GET("/followings", auth, h.ListFollowings)
+
+	// Tweet Like endpoint
+	r.POST("/tweet/:id/like", auth, socialLimit, h.LikeTweet)
+	r.DELETE("/tweet/:id/unlike", auth, socialLimit, h.UnlikeTweet)
+
+	// Hashtags endpoint
+	r.GET("/hashtags/:tag/tweets", auth, h.HashtagTweets)
+	r.GET("/trends", auth, h.Trends)
+
+	// Mentions endpoint
+	r.GET("/mentions", auth, h.ListMentions)
+
+	// Notifications endpoints
+	r.GET("/notifications", auth, h.ListNotifications)
+	r.POST("/notifications/read", auth, socialLimit, h.MarkNotificationsRead)
+
+	return r
+}
+
+// traced tells whether a request gets a span. Probes and scrapes would only
+// drown the traces that matter.
+func traced(r *http.Request) bool {
+	switch r.URL.Path {
+	case "/healthz", "/readyz", "/metrics":
+		return false
+	}
+	return true
+}
+
+// MetricsRoutes builds the router serving /metrics on the address of its
+// own, when METRICS_ADDR is set.
+func MetricsRoutes(cfg *config.Config) *gin.Engine {
+	r := gin.New()
+	r.Use(middlewares.Errors(), middlewares.Recovery())
+	r.NoRoute(middlewares.NoRoute)
+	r.GET("/metrics", middlewares.MetricsToken(cfg.Metrics.Token), gin.WrapH(metrics.Handler()))
+	return r
+}
@@ -0,0 +1,100 @@
+package blobs
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"io"
+	"main/models"
+	"main/storage"
+	"main/utils"
+	"time"
+)
+
+// Service stores files by content hash and keeps count of the references
+// to each of them.
+type Service struct {
+	DB      *gorm.DB
+	Storage storage.Storage
+}
+
+func New(db *gorm.DB, store storage.Storage) *Service {
+	return &Service{DB: db, Storage: store}
+}
+
+// Key returns the content-addressed storage key of a file.
+func Key(hash, ext string) string {
+	return "blobs/" + hash[:2] + "/" + hash[2:4] + "/" + hash + ext
+}
+
+// Store saves r under the SHA-256 of its content and takes a reference to
+// it. Uploading content that is already stored only bumps its reference
+// count.
+func (s *Service) Store(ctx context.Context, r io.ReadSeeker, ext, mimeType string) (string, error) {
+	hasher := sha256.New()
+	size, err := io.Copy(hasher, r)
+	if err != nil {
+		return "", err
+	}
+	hash := hex.EncodeToString(hasher.Sum(nil))
+	key := Key(hash, ext)
+
+	// Take the reference before looking for the file: the garbage collector
+	// skips blobs with references or a recent updated_at, and holds the row
+	// while it deletes a file, so this waits for it and then puts the file
+	// back.
+	blob := models.Blob{
+		Hash:     hash,
+		Key:      key,
+		Size:     size,
+		MimeType: mimeType,
+		RefCount: 1,
+	}
+	err = s.DB.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "hash"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"ref_count":  gorm.Expr("blobs.ref_count + 1"),
+			"updated_at": time.Now(),
+			"deleted_at": nil,
+		}),
+	}).Create(&blob).Error
+	if err != nil {
+		return "", err
+	}
+
+	_, err = s.Storage.Stat(ctx, key)
+	if errors.Is(err, storage.ErrNotFound) {
+		if _, err := r.Seek(0, io.SeekStart); err != nil {
+			return "", err
+		}
+		err = s.Storage.Put(ctx, key, r, size, mimeType)
+	}
+	if err != nil {
+		// Give the reference back, or the blob would never be collected.
+		if releaseErr := s.Release(ctx, key); releaseErr != nil {
+			return "", errors.Join(err, releaseErr)
+		}
+		return "", err
+	}
+
+	return key, nil
+}
+
+// Release drops a reference taken by Store. Files that end up without
+// references are deleted later by the garbage collector. Files saved before
+// content addressing have no blob row and are left to the collector as well.
+func (s *Service) Release(ctx context.Context, value string) error {
+	if value == "" {
+		return nil
+	}
+
+	return s.DB.WithContext(ctx).Model(&models.Blob{}).
+		Where("storage_key = ? AND ref_count > 0", utils.StorageKey(value)).
+		UpdateColumns(map[string]interface{}{
+			"ref_count":  gorm.Expr("ref_count - 1"),
+			"updated_at": time.Now(),
+		}).Error
+}
@@ -0,0 +1,154 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"main/config"
+	"main/logging"
+	"main/tracing"
+	"time"
+)
+
+const usage = `usage: minitwitter [command]
+
+commands:
+  serve            run the API server and background jobs (the default)
+  migrate          apply, revert, list or create database migrations
+  user             create, suspend, reset the password of or promote a user
+  tweet purge      hard delete tweets with everything attached to them
+  media gc         collect unattached media and orphan files
+  reindex-search   re-extract the hashtags and mentions of every tweet
+  recount          recompute the like, follower, following and tweet counts
+  seed             fill an empty database with generated data
+
+Run a command with -h for its options.`
+
+// command runs a subcommand with the arguments following its name.
+type command func(cfg *config.Config, args []string) error
+
+var commands = map[string]command{
+	"serve":          runServe,
+	"migrate":        runMigrate,
+	"user":           runUser,
+	"tweet":          runTweet,
+	"media":          runMedia,
+	"reindex-search": runReindexSearch,
+	"recount":        runRecount,
+	"seed":           runSeed,
+}
+
+// Run loads the configuration and runs the subcommand named by args[0], or
+// the server if there is none. Asking for help needs no configuration.
+func Run(args []string) error {
+	if len(args) > 0 && (args[0] == "help" || args[0] == "-h" || args[0] == "--help") {
+		fmt.Println(usage)
+		return nil
+	}
+
+	run, name := runServe, "serve"
+	if len(args) > 0 {
+		var ok bool
+		if run, ok = commands[args[0]]; !ok {
+			return fmt.Errorf("unknown command %q\n\n%s", args[0], usage)
+		}
+		name, args = args[0], args[1:]
+	}
+
+	// Commands print their usage before they use the configuration.
+	if wantsHelp(args) {
+		return run(config.Default(), args)
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("invalid configuration: %w", err)
+	}
+	logging.Setup(cfg.Log)
+
+	shutdown, err := tracing.Setup(context.Background(), cfg.Tracing)
+	if err != nil {
+		return fmt.Errorf("setting up tracing: %w", err)
+	}
+	defer func() {
+		// Flush the spans still buffered, without hanging on an
+		// unreachable collector.
+		ctx, cancel := context.WithTimeout(context.Background(), flushTimeout)
+		defer cancel()
+		if err := shutdown(ctx); err != nil {
+			slog.Warn("Failed to flush traces", "command", name, "error", err)
+		}
+	}()
+
+	return run(cfg, args)
+}
+
+// flushTimeout bounds how long exiting waits for spans to be exported.
+const flushTimeout = 5 * time.Second
+
+// newFlags returns a flag set that reports errors instead of exiting, with
+// usage printed before the flag defaults on -h.
+func newFlags(name, usage string) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.Usage = func() {
+		out := flags.Output()
+		fmt.Fprintln(out, usage)
+		if hasFlags(flags) {
+			fmt.Fprintln(out, "\noptions:")
+			flags.PrintDefaults()
+		}
+	}
+	return flags
+}
+
+func hasFlags(flags *flag.FlagSet) bool {
+	found := false
+	flags.VisitAll(func(*flag.Flag) { found = true })
+	return found
+}
+
+// parse parses args into flags and checks the number of positional
+// arguments left, which must be between min and max (-1 for no limit).
+func parse(flags *flag.FlagSet, args []string, min, max int) error {
+	flags.SetOutput(io.Discard)
+	err := flags.Parse(args)
+	flags.SetOutput(nil)
+	if errors.Is(err, flag.ErrHelp) {
+		flags.Usage()
+		return errHelp
+	}
+	if err == nil && (flags.NArg() < min || (max >= 0 && flags.NArg() > max)) {
+		err = errors.New("wrong number of arguments")
+	}
+	if err != nil {
+		flags.Usage()
+		return err
+	}
+	return nil
+}
+
+// wantsHelp reports whether args, the arguments of a command, ask for its
+// usage.
+func wantsHelp(args []string) bool {
+	for _, arg := range args {
+		switch arg {
+		case "--":
+			return false
+		case "-h", "-help", "--help":
+			return true
+		}
+	}
+	return false
+}
+
+// errHelp is returned after printing the usage of a command on -h, and is
+// not reported as an error.
+var errHelp = errors.New("help requested")
+
+// IsHelp reports whether err only means the usage was printed.
+func IsHelp(err error) bool {
+	return errors.Is(err, errHelp)
+}
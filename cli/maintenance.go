@@ -0,0 +1,98 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"main/app"
+	"main/config"
+	"main/jobs"
+	"time"
+)
+
+func runMedia(cfg *config.Config, args []string) error {
+	const usage = "usage: minitwitter media gc [-dry-run] [-ttl d] [-safety-window d]"
+	if len(args) == 0 || args[0] != "gc" {
+		return errors.New(usage)
+	}
+
+	flags := newFlags("media gc", usage)
+	dryRun := flags.Bool("dry-run", false, "only report what would be deleted")
+	ttl := flags.Duration("ttl", 24*time.Hour, "age after which unattached media are collected")
+	safetyWindow := flags.Duration("safety-window", 24*time.Hour, "files changed more recently are never deleted")
+	if err := parse(flags, args[1:], 0, 0); err != nil {
+		return err
+	}
+
+	application, err := app.New(cfg)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	collected, err := application.Jobs.CollectUnattachedMedia(ctx, time.Now().Add(-*ttl), *dryRun)
+	if err != nil {
+		return err
+	}
+	if *dryRun {
+		fmt.Printf("Unattached media: would collect %d\n", collected)
+	} else {
+		fmt.Printf("Unattached media: collected %d\n", collected)
+	}
+
+	report, err := application.Jobs.CollectOrphanFiles(ctx, *safetyWindow, *dryRun)
+	if err != nil {
+		return err
+	}
+	if *dryRun {
+		for _, orphan := range report.Orphans {
+			fmt.Printf("Would delete %s (%d bytes)\n", orphan.Key, orphan.Size)
+		}
+		fmt.Printf("Files: scanned %d, %d orphans, %d bytes reclaimable\n",
+			report.Scanned, len(report.Orphans), report.Bytes)
+	} else {
+		fmt.Printf("Files: scanned %d, deleted %d of %d orphans (%d bytes)\n",
+			report.Scanned, report.Deleted, len(report.Orphans), report.Bytes)
+	}
+	return nil
+}
+
+func runReindexSearch(cfg *config.Config, args []string) error {
+	flags := newFlags("reindex-search", "usage: minitwitter reindex-search")
+	if err := parse(flags, args, 0, 0); err != nil {
+		return err
+	}
+
+	application, err := app.New(cfg)
+	if err != nil {
+		return err
+	}
+
+	indexed, err := application.Jobs.ReindexSearch(context.Background())
+	fmt.Printf("Reindexed %d tweets\n", indexed)
+	return err
+}
+
+func runRecount(cfg *config.Config, args []string) error {
+	flags := newFlags("recount", "usage: minitwitter recount")
+	if err := parse(flags, args, 0, 0); err != nil {
+		return err
+	}
+
+	// Counters only live in the database, storage and Redis aren't needed.
+	db, err := app.OpenDB(cfg)
+	if err != nil {
+		return err
+	}
+
+	report, err := jobs.NewRunner(db, nil, "").ReconcileCounters(context.Background())
+	if err != nil {
+		return err
+	}
+	for _, drift := range report.Drift {
+		fmt.Printf("%s.%s of row %d was %d instead of %d, fixed\n",
+			drift.Table, drift.Column, drift.ID, drift.Stored, drift.Actual)
+	}
+	fmt.Printf("Checked %d counters, fixed %d drifted rows\n", report.Checked, len(report.Drift))
+	return nil
+}
@@ -0,0 +1,103 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"main/config"
+	"main/initializers"
+	"main/migrations"
+	"strconv"
+)
+
+const migrateUsage = `usage: minitwitter migrate <command>
+
+commands:
+  up [n]         apply all pending migrations, or the next n
+  down [n]       revert the last migration, or the last n
+  status         list migrations and whether they are applied
+  create <name>  add empty up and down files to the migrations directory`
+
+// runMigrate implements the migrate subcommand.
+func runMigrate(cfg *config.Config, args []string) error {
+	if len(args) == 0 {
+		return errors.New(migrateUsage)
+	}
+	if wantsHelp(args) {
+		fmt.Println(migrateUsage)
+		return errHelp
+	}
+
+	if args[0] == "create" {
+		if len(args) != 2 {
+			return errors.New(migrateUsage)
+		}
+		files, err := migrations.Create("migrations", args[1])
+		for _, file := range files {
+			fmt.Println("Created", file)
+		}
+		return err
+	}
+
+	db, err := initializers.ConnectToDB(cfg)
+	if err != nil {
+		return err
+	}
+	migrator, err := migrations.New(db)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+
+	count := func(fallback int) (int, error) {
+		if len(args) < 2 {
+			return fallback, nil
+		}
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n < 1 {
+			return 0, fmt.Errorf("invalid migration count %q", args[1])
+		}
+		return n, nil
+	}
+
+	switch args[0] {
+	case "up":
+		n, err := count(0)
+		if err != nil {
+			return err
+		}
+		done, err := migrator.Up(ctx, n)
+		for _, migration := range done {
+			fmt.Printf("Applied %d_%s\n", migration.Version, migration.Name)
+		}
+		if err == nil && len(done) == 0 {
+			fmt.Println("Nothing to apply, the schema is up to date")
+		}
+		return err
+	case "down":
+		n, err := count(1)
+		if err != nil {
+			return err
+		}
+		done, err := migrator.Down(ctx, n)
+		for _, migration := range done {
+			fmt.Printf("Reverted %d_%s\n", migration.Version, migration.Name)
+		}
+		return err
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		for _, status := range statuses {
+			applied := "pending"
+			if status.AppliedAt != nil {
+				applied = "applied " + status.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%04d_%-30s %s\n", status.Version, status.Name, applied)
+		}
+		return nil
+	default:
+		return errors.New(migrateUsage)
+	}
+}
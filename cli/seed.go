@@ -0,0 +1,50 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"main/app"
+	"main/config"
+	"main/seed"
+	"time"
+)
+
+func runSeed(cfg *config.Config, args []string) error {
+	flags := newFlags("seed", "usage: minitwitter seed [options]\n\nFills an empty database with generated users, follows, tweets and likes.")
+	opts := seed.Options{}
+	flags.Int64Var(&opts.Seed, "seed", 1, "random seed, the same seed gives the same data")
+	flags.IntVar(&opts.Users, "users", 100, "number of users")
+	flags.IntVar(&opts.Follows, "follows", 20, "average number of users each user follows")
+	flags.IntVar(&opts.TweetsPerUser, "tweets", 10, "average number of tweets per user")
+	flags.IntVar(&opts.LikesPerTweet, "likes", 3, "average number of likes per tweet")
+	flags.Float64Var(&opts.ImageRatio, "images", 0.1, "share of tweets with a placeholder image")
+	flags.StringVar(&opts.Password, "password", "Passw0rd!", "password of every user")
+	flags.IntVar(&opts.Days, "days", 30, "number of days the data is spread over")
+	if err := parse(flags, args, 0, 0); err != nil {
+		return err
+	}
+	if opts.Users < 1 || opts.Follows < 0 || opts.TweetsPerUser < 0 || opts.LikesPerTweet < 0 || opts.Days < 1 {
+		return errors.New("-users and -days must be positive, -follows, -tweets and -likes not negative")
+	}
+	if opts.ImageRatio < 0 || opts.ImageRatio > 1 {
+		return errors.New("-images must be between 0 and 1")
+	}
+
+	application, err := app.New(cfg)
+	if err != nil {
+		return err
+	}
+
+	started := time.Now()
+	report, err := seed.Run(context.Background(), application.DB, application.Handler.Blobs, opts)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Seeded %d users, %d follows, %d tweets, %d likes, %d hashtags, %d mentions and %d images in %s\n",
+		report.Users, report.Follows, report.Tweets, report.Likes, report.Hashtags, report.Mentions, report.Images,
+		time.Since(started).Round(time.Millisecond))
+	fmt.Printf("Every user's password is %s\n", opts.Password)
+	return nil
+}
@@ -0,0 +1,29 @@
+package cli
+
+import (
+	"context"
+	"main/app"
+	"main/config"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+func runServe(cfg *config.Config, args []string) error {
+	flags := newFlags("serve", "usage: minitwitter serve")
+	if err := parse(flags, args, 0, 0); err != nil {
+		return err
+	}
+
+	application, err := app.New(cfg)
+	if err != nil {
+		return err
+	}
+
+	// SIGTERM is what orchestrators send before killing the process, SIGINT
+	// is Ctrl-C.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	return application.Serve(ctx)
+}
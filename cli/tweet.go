@@ -0,0 +1,86 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"main/app"
+	"main/config"
+	"main/models"
+	"main/repositories"
+	"strconv"
+)
+
+const tweetUsage = `usage: minitwitter tweet <command>
+
+commands:
+  purge [-deleted] [id...]   hard delete tweets with their media, likes,
+                             hashtags, mentions and notifications; -deleted
+                             purges every soft deleted tweet`
+
+func runTweet(cfg *config.Config, args []string) error {
+	if len(args) == 0 || args[0] != "purge" {
+		return errors.New(tweetUsage)
+	}
+
+	flags := newFlags("tweet purge", "usage: minitwitter tweet purge [-deleted] [id...]")
+	deleted := flags.Bool("deleted", false, "purge every soft deleted tweet")
+	if err := parse(flags, args[1:], 0, -1); err != nil {
+		return err
+	}
+
+	var ids []uint
+	for _, arg := range flags.Args() {
+		id, err := strconv.ParseUint(arg, 10, 0)
+		if err != nil {
+			return fmt.Errorf("invalid tweet ID %q", arg)
+		}
+		ids = append(ids, uint(id))
+	}
+	if len(ids) == 0 && !*deleted {
+		flags.Usage()
+		return errors.New("no tweets to purge")
+	}
+
+	application, err := app.New(cfg)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+
+	if *deleted {
+		var softDeleted []uint
+		err := application.DB.WithContext(ctx).Unscoped().Model(&models.Tweet{}).
+			Where("deleted_at IS NOT NULL").
+			Pluck("id", &softDeleted).Error
+		if err != nil {
+			return err
+		}
+		ids = append(ids, softDeleted...)
+	}
+
+	purged := 0
+	for _, id := range ids {
+		files, err := application.Handler.Repos.Tweets.Purge(ctx, id)
+		if errors.Is(err, repositories.ErrNotFound) {
+			fmt.Printf("Tweet %d not found\n", id)
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("purging tweet %d: %w", id, err)
+		}
+		purged++
+
+		// The file garbage collector deletes the files once nothing else
+		// references them.
+		for _, file := range files {
+			if err := application.Handler.Blobs.Release(ctx, file); err != nil {
+				slog.WarnContext(ctx, "Failed to release file", "file", file, "error", err)
+			}
+		}
+	}
+
+	fmt.Printf("Purged %d tweets\n", purged)
+	return nil
+}
@@ -0,0 +1,245 @@
+package cli
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/bcrypt"
+	"io"
+	"main/app"
+	"main/config"
+	"main/models"
+	"main/repositories"
+	"main/utils"
+	"math/big"
+	"os"
+	"strings"
+	"time"
+)
+
+const userUsage = `usage: minitwitter user <command>
+
+commands:
+  create [-admin] [-password-stdin] <username> <email>
+  suspend [-undo] <username>
+  reset-password [-password-stdin] <username>
+  promote [-role admin|user] <username>
+
+With -password-stdin, the password is read from the first line of the
+standard input, so it doesn't show up in the process list or the shell
+history. Without it, a random password is generated and printed.`
+
+func runUser(cfg *config.Config, args []string) error {
+	if len(args) == 0 {
+		return errors.New(userUsage)
+	}
+
+	switch args[0] {
+	case "create":
+		return runUserCreate(cfg, args[1:])
+	case "suspend":
+		return runUserSuspend(cfg, args[1:])
+	case "reset-password":
+		return runUserResetPassword(cfg, args[1:])
+	case "promote":
+		return runUserPromote(cfg, args[1:])
+	default:
+		return errors.New(userUsage)
+	}
+}
+
+func runUserCreate(cfg *config.Config, args []string) error {
+	flags := newFlags("user create", "usage: minitwitter user create [-admin] [-password-stdin] <username> <email>")
+	admin := flags.Bool("admin", false, "give the user the admin role")
+	passwordStdin := flags.Bool("password-stdin", false, "read the password of the user from the standard input")
+	if err := parse(flags, args, 2, 2); err != nil {
+		return err
+	}
+	userName, email := flags.Arg(0), flags.Arg(1)
+
+	if !utils.IsValidEmail(email) {
+		return errors.New("invalid email format")
+	}
+	plain, generated, err := choosePassword(*passwordStdin, os.Stdin)
+	if err != nil {
+		return err
+	}
+
+	db, err := app.OpenDB(cfg)
+	if err != nil {
+		return err
+	}
+	users := repositories.New(db).Users
+	ctx := context.Background()
+
+	if _, err := users.FindByUserName(ctx, userName); err == nil {
+		return fmt.Errorf("username %s is already used", userName)
+	} else if !errors.Is(err, repositories.ErrNotFound) {
+		return err
+	}
+	if _, err := users.FindByEmail(ctx, email); err == nil {
+		return fmt.Errorf("email %s is already used", email)
+	} else if !errors.Is(err, repositories.ErrNotFound) {
+		return err
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(plain), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	user := models.User{
+		UserName: userName,
+		Email:    email,
+		Password: string(hash),
+		Role:     models.RoleUser,
+	}
+	if *admin {
+		user.Role = models.RoleAdmin
+	}
+	if err := users.Create(ctx, &user); err != nil {
+		return err
+	}
+
+	fmt.Printf("Created %s user %s with ID %d\n", user.Role, user.UserName, user.ID)
+	if generated {
+		fmt.Println("Password:", plain)
+	}
+	return nil
+}
+
+func runUserSuspend(cfg *config.Config, args []string) error {
+	flags := newFlags("user suspend", "usage: minitwitter user suspend [-undo] <username>")
+	undo := flags.Bool("undo", false, "lift the suspension instead")
+	if err := parse(flags, args, 1, 1); err != nil {
+		return err
+	}
+
+	return updateUser(cfg, flags.Arg(0), func(user *models.User) string {
+		if *undo {
+			user.SuspendedAt = nil
+			return "Lifted the suspension of"
+		}
+		if user.SuspendedAt == nil {
+			now := time.Now()
+			user.SuspendedAt = &now
+		}
+		return "Suspended"
+	})
+}
+
+func runUserResetPassword(cfg *config.Config, args []string) error {
+	flags := newFlags("user reset-password", "usage: minitwitter user reset-password [-password-stdin] <username>")
+	passwordStdin := flags.Bool("password-stdin", false, "read the new password of the user from the standard input")
+	if err := parse(flags, args, 1, 1); err != nil {
+		return err
+	}
+
+	plain, generated, err := choosePassword(*passwordStdin, os.Stdin)
+	if err != nil {
+		return err
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(plain), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	err = updateUser(cfg, flags.Arg(0), func(user *models.User) string {
+		user.Password = string(hash)
+		return "Reset the password of"
+	})
+	if err == nil && generated {
+		fmt.Println("Password:", plain)
+	}
+	return err
+}
+
+func runUserPromote(cfg *config.Config, args []string) error {
+	flags := newFlags("user promote", "usage: minitwitter user promote [-role admin|user] <username>")
+	role := flags.String("role", models.RoleAdmin, "role to give the user")
+	if err := parse(flags, args, 1, 1); err != nil {
+		return err
+	}
+	if *role != models.RoleAdmin && *role != models.RoleUser {
+		return fmt.Errorf("unknown role %q, must be %s or %s", *role, models.RoleAdmin, models.RoleUser)
+	}
+
+	return updateUser(cfg, flags.Arg(0), func(user *models.User) string {
+		user.Role = *role
+		return "Gave the " + *role + " role to"
+	})
+}
+
+// updateUser loads a user by username, lets change modify it and saves it.
+// change returns what it did, to print before the username.
+func updateUser(cfg *config.Config, userName string, change func(user *models.User) string) error {
+	db, err := app.OpenDB(cfg)
+	if err != nil {
+		return err
+	}
+	users := repositories.New(db).Users
+	ctx := context.Background()
+
+	user, err := users.FindByUserName(ctx, userName)
+	if errors.Is(err, repositories.ErrNotFound) {
+		return fmt.Errorf("no user named %s", userName)
+	}
+	if err != nil {
+		return err
+	}
+
+	done := change(&user)
+	if err := users.Save(ctx, &user); err != nil {
+		return err
+	}
+
+	fmt.Println(done, user.UserName)
+	return nil
+}
+
+// choosePassword reads a password from the first line of stdin and checks
+// it against the sign up rules, or generates one if fromStdin is false. It
+// reports whether the password was generated.
+func choosePassword(fromStdin bool, stdin io.Reader) (string, bool, error) {
+	if !fromStdin {
+		generated, err := generatePassword()
+		return generated, true, err
+	}
+
+	line, err := bufio.NewReader(stdin).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", false, fmt.Errorf("reading the password: %w", err)
+	}
+	password := strings.TrimRight(line, "\r\n")
+
+	if len(password) < 8 {
+		return "", false, errors.New("password must be at least 8 characters long")
+	}
+	if !utils.IsStrongPassword(password) {
+		return "", false, errors.New("password must contain at least one uppercase letter, one lowercase letter, one number, and one special character")
+	}
+	return password, false, nil
+}
+
+const passwordAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz23456789!@#$%&*-_"
+
+// generatePassword returns a random 16 character password that passes the
+// sign up rules.
+func generatePassword() (string, error) {
+	max := big.NewInt(int64(len(passwordAlphabet)))
+	for {
+		password := make([]byte, 16)
+		for i := range password {
+			n, err := rand.Int(rand.Reader, max)
+			if err != nil {
+				return "", err
+			}
+			password[i] = passwordAlphabet[n.Int64()]
+		}
+		if utils.IsStrongPassword(string(password)) {
+			return string(password), nil
+		}
+	}
+}
@@ -0,0 +1,485 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+	"io/fs"
+	"net"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MaxVideoSize is the largest video that can be uploaded, and so the largest
+// file a request or a resumable upload ever needs to carry.
+const MaxVideoSize = 256 << 20
+
+// Config holds every setting of the server. It is loaded once at startup by
+// Load and handed to whatever needs it.
+type Config struct {
+	Port      string          `yaml:"port" env:"PORT"`
+	Server    ServerConfig    `yaml:"server"`
+	DB        DBConfig        `yaml:"db"`
+	Auth      AuthConfig      `yaml:"auth"`
+	Storage   StorageConfig   `yaml:"storage"`
+	Uploads   UploadsConfig   `yaml:"uploads"`
+	CORS      CORSConfig      `yaml:"cors"`
+	Log       LogConfig       `yaml:"log"`
+	Metrics   MetricsConfig   `yaml:"metrics"`
+	Tracing   TracingConfig   `yaml:"tracing"`
+	RateLimit RateLimitConfig `yaml:"rate_limit"`
+}
+
+// ServerConfig holds the timeouts of the HTTP server. Read and write
+// timeouts cover whole requests and responses, so they must leave room for
+// the largest upload and download.
+type ServerConfig struct {
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout" env:"HTTP_READ_HEADER_TIMEOUT"`
+	ReadTimeout       time.Duration `yaml:"read_timeout" env:"HTTP_READ_TIMEOUT"`
+	WriteTimeout      time.Duration `yaml:"write_timeout" env:"HTTP_WRITE_TIMEOUT"`
+	IdleTimeout       time.Duration `yaml:"idle_timeout" env:"HTTP_IDLE_TIMEOUT"`
+	// ShutdownTimeout is how long in-flight requests and background jobs
+	// get to finish after SIGTERM.
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" env:"HTTP_SHUTDOWN_TIMEOUT"`
+	// TrustedProxies lists the addresses or CIDRs of the proxies whose
+	// X-Forwarded-For header is believed. Clients are told apart by their
+	// IP address, which anyone else could fake.
+	TrustedProxies []string `yaml:"trusted_proxies" env:"HTTP_TRUSTED_PROXIES"`
+}
+
+type DBConfig struct {
+	// Driver is postgres or sqlite. SQLite keeps everything in the file at
+	// Path and needs no server, for development and CI.
+	Driver          string        `yaml:"driver" env:"DB_DRIVER"`
+	Path            string        `yaml:"path" env:"DB_PATH"`
+	Host            string        `yaml:"host" env:"DB_HOST"`
+	Port            int           `yaml:"port" env:"DB_PORT"`
+	User            string        `yaml:"user" env:"DB_USER"`
+	Password        string        `yaml:"password" env:"DB_PASSWORD"`
+	Name            string        `yaml:"name" env:"DB_NAME"`
+	SSLMode         string        `yaml:"ssl_mode" env:"DB_SSLMODE"`
+	SSLRootCert     string        `yaml:"ssl_root_cert" env:"DB_SSLROOTCERT"`
+	MaxOpenConns    int           `yaml:"max_open_conns" env:"DB_MAX_OPEN_CONNS"`
+	MaxIdleConns    int           `yaml:"max_idle_conns" env:"DB_MAX_IDLE_CONNS"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime" env:"DB_CONN_MAX_LIFETIME"`
+	ConnMaxIdleTime time.Duration `yaml:"conn_max_idle_time" env:"DB_CONN_MAX_IDLE_TIME"`
+}
+
+// DSN returns the connection string of the database.
+func (db DBConfig) DSN() string {
+	if db.Driver == "sqlite" {
+		// Wait for locks instead of failing with SQLITE_BUSY, and enforce
+		// foreign keys like Postgres does.
+		return db.Path + "?_pragma=busy_timeout(5000)&_pragma=foreign_keys(1)&_pragma=journal_mode(WAL)"
+	}
+
+	dsn := fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%d sslmode=%s",
+		dsnValue(db.Host), dsnValue(db.User), dsnValue(db.Password), dsnValue(db.Name), db.Port, dsnValue(db.SSLMode))
+	if db.SSLRootCert != "" {
+		dsn += " sslrootcert=" + dsnValue(db.SSLRootCert)
+	}
+	return dsn
+}
+
+// dsnValue quotes a value of a key=value connection string, so that spaces,
+// quotes and backslashes, in a password say, can't break it up.
+func dsnValue(value string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(value) + "'"
+}
+
+type AuthConfig struct {
+	Secret          string        `yaml:"secret" env:"SECRET"`
+	AccessTokenTTL  time.Duration `yaml:"access_token_ttl" env:"ACCESS_TOKEN_TTL"`
+	RefreshTokenTTL time.Duration `yaml:"refresh_token_ttl" env:"REFRESH_TOKEN_TTL"`
+	CookieSecure    bool          `yaml:"cookie_secure" env:"COOKIE_SECURE"`
+}
+
+type StorageConfig struct {
+	Driver       string `yaml:"driver" env:"STORAGE_DRIVER"`
+	Path         string `yaml:"path" env:"STORAGE_PATH"`
+	URLSecret    string `yaml:"url_secret" env:"MEDIA_URL_SECRET"`
+	S3Endpoint   string `yaml:"s3_endpoint" env:"S3_ENDPOINT"`
+	S3AccessKey  string `yaml:"s3_access_key" env:"S3_ACCESS_KEY"`
+	S3SecretKey  string `yaml:"s3_secret_key" env:"S3_SECRET_KEY"`
+	S3Bucket     string `yaml:"s3_bucket" env:"S3_BUCKET"`
+	S3Region     string `yaml:"s3_region" env:"S3_REGION"`
+	S3UseSSL     bool   `yaml:"s3_use_ssl" env:"S3_USE_SSL"`
+	FileGCDryRun bool   `yaml:"file_gc_dry_run" env:"FILE_GC_DRY_RUN"`
+	// ResumableDir holds partial resumable uploads, see the resumable
+	// controllers for running several replicas.
+	ResumableDir string `yaml:"resumable_dir" env:"RESUMABLE_UPLOAD_DIR"`
+}
+
+type UploadsConfig struct {
+	// MaxFormMemory is how much of a multipart form is kept in memory, the
+	// rest is spilled to temporary files.
+	MaxFormMemory int64 `yaml:"max_form_memory" env:"UPLOAD_MAX_FORM_MEMORY"`
+	// MaxRequestSize caps the body of every request, so a client can't
+	// fill the disk with a form that is spilled to temporary files. It must
+	// leave room for the largest video and the rest of its form, and for
+	// the chunks of resumable uploads.
+	MaxRequestSize   int64       `yaml:"max_request_size" env:"UPLOAD_MAX_REQUEST_SIZE"`
+	MaxResumableSize int64       `yaml:"max_resumable_size" env:"UPLOAD_MAX_RESUMABLE_SIZE"`
+	UserQuota        QuotaConfig `yaml:"user_quota" env:"USER"`
+	AdminQuota       QuotaConfig `yaml:"admin_quota" env:"ADMIN"`
+}
+
+// QuotaConfig limits what users of a role can upload. Zero means unlimited.
+type QuotaConfig struct {
+	MaxBytes       int64 `yaml:"max_bytes" env:"STORAGE_QUOTA_%s_BYTES"`
+	MaxFiles       int64 `yaml:"max_files" env:"STORAGE_QUOTA_%s_FILES"`
+	UploadsPerHour int   `yaml:"uploads_per_hour" env:"UPLOAD_RATE_%s_PER_HOUR"`
+}
+
+type CORSConfig struct {
+	// AllowedOrigins lists the origins allowed to call the API from a
+	// browser, "*" allows any. CORS is off when it is empty.
+	AllowedOrigins   []string      `yaml:"allowed_origins" env:"CORS_ALLOWED_ORIGINS"`
+	AllowCredentials bool          `yaml:"allow_credentials" env:"CORS_ALLOW_CREDENTIALS"`
+	MaxAge           time.Duration `yaml:"max_age" env:"CORS_MAX_AGE"`
+}
+
+type LogConfig struct {
+	// Level is the lowest level logged: debug, info, warn or error.
+	Level string `yaml:"level" env:"LOG_LEVEL"`
+	// Format is text for humans or json for log collectors.
+	Format string `yaml:"format" env:"LOG_FORMAT"`
+}
+
+// MetricsConfig controls the Prometheus endpoint, /metrics. It is off by
+// default. It is served on the API port unless Addr is set, and requires
+// Token as a bearer token when it is set. On the API port, which is public,
+// a token is required.
+type MetricsConfig struct {
+	Enabled bool   `yaml:"enabled" env:"METRICS_ENABLED"`
+	Addr    string `yaml:"addr" env:"METRICS_ADDR"`
+	Token   string `yaml:"token" env:"METRICS_TOKEN"`
+}
+
+type TracingConfig struct {
+	// Exporter is none, stdout to print spans for local runs, or otlp to
+	// send them over OTLP/HTTP to Endpoint.
+	Exporter string `yaml:"exporter" env:"TRACING_EXPORTER"`
+	// Endpoint is the URL of the collector, e.g. http://localhost:4318.
+	Endpoint    string `yaml:"endpoint" env:"OTEL_EXPORTER_OTLP_ENDPOINT"`
+	ServiceName string `yaml:"service_name" env:"OTEL_SERVICE_NAME"`
+	// SampleRatio is the share of traces started here that are recorded.
+	// Requests that are part of a sampled trace are always recorded.
+	SampleRatio float64 `yaml:"sample_ratio" env:"TRACING_SAMPLE_RATIO"`
+}
+
+// RateLimitConfig holds the rate limits of the route groups. Clients are
+// told apart by user ID once authenticated and by IP address otherwise.
+type RateLimitConfig struct {
+	Enabled bool `yaml:"enabled" env:"RATE_LIMIT_ENABLED"`
+	// Store is memory, which only limits each replica on its own, or redis
+	// to share the limits between replicas.
+	Store    string `yaml:"store" env:"RATE_LIMIT_STORE"`
+	RedisURL string `yaml:"redis_url" env:"REDIS_URL"`
+	// Auth covers sign up, login and token refresh.
+	Auth RateLimitPolicy `yaml:"auth" env:"AUTH"`
+	// Tweets covers creating, editing and deleting tweets.
+	Tweets RateLimitPolicy `yaml:"tweets" env:"TWEETS"`
+	// Social covers follows and likes.
+	Social RateLimitPolicy `yaml:"social" env:"SOCIAL"`
+	// Uploads covers media uploads and the creation of resumable uploads.
+	Uploads RateLimitPolicy `yaml:"uploads" env:"UPLOADS"`
+}
+
+// RateLimitPolicy lets Limit requests through per Period, in bursts of up
+// to Burst requests (Limit if zero). A zero Limit disables it.
+type RateLimitPolicy struct {
+	Limit  int           `yaml:"limit" env:"RATE_LIMIT_%s_LIMIT"`
+	Period time.Duration `yaml:"period" env:"RATE_LIMIT_%s_PERIOD"`
+	Burst  int           `yaml:"burst" env:"RATE_LIMIT_%s_BURST"`
+}
+
+// Default returns the configuration used for anything that isn't set.
+func Default() *Config {
+	return &Config{
+		Port: "8080",
+		Server: ServerConfig{
+			ReadHeaderTimeout: 10 * time.Second,
+			ReadTimeout:       5 * time.Minute,
+			WriteTimeout:      5 * time.Minute,
+			IdleTimeout:       2 * time.Minute,
+			ShutdownTimeout:   30 * time.Second,
+		},
+		DB: DBConfig{
+			Driver:          "postgres",
+			Path:            "minitwitter.db",
+			Host:            "localhost",
+			Port:            5432,
+			SSLMode:         "disable",
+			MaxOpenConns:    25,
+			MaxIdleConns:    5,
+			ConnMaxLifetime: time.Hour,
+			ConnMaxIdleTime: 10 * time.Minute,
+		},
+		Auth: AuthConfig{
+			AccessTokenTTL:  time.Hour,
+			RefreshTokenTTL: 24 * time.Hour,
+		},
+		Storage: StorageConfig{
+			Driver:       "local",
+			Path:         "uploads",
+			ResumableDir: "uploads/.resumable",
+		},
+		Uploads: UploadsConfig{
+			MaxFormMemory:    30 << 20,
+			MaxRequestSize:   MaxVideoSize + 1<<20,
+			MaxResumableSize: MaxVideoSize,
+			UserQuota:        QuotaConfig{MaxBytes: 1 << 30, MaxFiles: 1000, UploadsPerHour: 60},
+		},
+		CORS: CORSConfig{
+			MaxAge: 12 * time.Hour,
+		},
+		Log: LogConfig{
+			Level:  "info",
+			Format: "text",
+		},
+		Tracing: TracingConfig{
+			Exporter:    "none",
+			ServiceName: "minitwitter",
+			SampleRatio: 1,
+		},
+		RateLimit: RateLimitConfig{
+			Enabled: true,
+			Store:   "memory",
+			Auth:    RateLimitPolicy{Limit: 10, Period: time.Minute, Burst: 5},
+			Tweets:  RateLimitPolicy{Limit: 30, Period: time.Minute, Burst: 10},
+			Social:  RateLimitPolicy{Limit: 60, Period: time.Minute, Burst: 20},
+			Uploads: RateLimitPolicy{Limit: 20, Period: time.Minute, Burst: 5},
+		},
+	}
+}
+
+// Load builds the configuration from the defaults, then the YAML file named
+// by CONFIG_FILE (or config.yaml if it exists), then the environment. A .env
+// file is loaded into the environment first if there is one; variables that
+// are already set win over it.
+func Load() (*Config, error) {
+	if err := godotenv.Load(); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("loading .env: %w", err)
+	}
+
+	cfg := Default()
+
+	path, required := os.Getenv("CONFIG_FILE"), true
+	if path == "" {
+		path, required = "config.yaml", false
+	}
+	data, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		if err := yaml.Unmarshal(data, cfg); err != nil {
+			return nil, fmt.Errorf("parsing %s: %w", path, err)
+		}
+	case required || !errors.Is(err, fs.ErrNotExist):
+		return nil, fmt.Errorf("reading %s: %w", path, err)
+	}
+
+	if err := loadEnv(reflect.ValueOf(cfg).Elem(), ""); err != nil {
+		return nil, err
+	}
+
+	// The URL secret used to fall back to the JWT secret, keep doing so.
+	if cfg.Storage.URLSecret == "" {
+		cfg.Storage.URLSecret = cfg.Auth.Secret
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// loadEnv overrides the fields of v that have an env tag with the variables
+// that are set and not empty. The tags of nested structs are prefixes filled into the %s of
+// their fields' tags.
+func loadEnv(v reflect.Value, prefix string) error {
+	for i := 0; i < v.NumField(); i++ {
+		field, value := v.Type().Field(i), v.Field(i)
+		name := field.Tag.Get("env")
+
+		if field.Type.Kind() == reflect.Struct {
+			if err := loadEnv(value, name); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if name == "" {
+			continue
+		}
+		if strings.Contains(name, "%s") {
+			name = fmt.Sprintf(name, prefix)
+		}
+		raw := strings.TrimSpace(os.Getenv(name))
+		if raw == "" {
+			continue
+		}
+		if err := setField(value, raw); err != nil {
+			return fmt.Errorf("invalid %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+func setField(value reflect.Value, raw string) error {
+	if value.Type() == reflect.TypeOf(time.Duration(0)) {
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return err
+		}
+		value.SetInt(int64(d))
+		return nil
+	}
+
+	switch value.Kind() {
+	case reflect.String:
+		value.SetString(raw)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return err
+		}
+		value.SetBool(b)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return err
+		}
+		value.SetInt(n)
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return err
+		}
+		value.SetFloat(f)
+	case reflect.Slice:
+		var items []string
+		for _, item := range strings.Split(raw, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		value.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("unsupported type %s", value.Type())
+	}
+	return nil
+}
+
+var logLevels = map[string]bool{"debug": true, "info": true, "warn": true, "error": true}
+
+var sslModes = map[string]bool{
+	"disable": true, "allow": true, "prefer": true,
+	"require": true, "verify-ca": true, "verify-full": true,
+}
+
+// Validate reports every setting that is missing or out of range.
+func (cfg *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(cfg.Port != "", "PORT is required")
+	check(cfg.Server.ReadHeaderTimeout >= 0 && cfg.Server.ReadTimeout >= 0 &&
+		cfg.Server.WriteTimeout >= 0 && cfg.Server.IdleTimeout >= 0,
+		"HTTP_*_TIMEOUT can't be negative")
+	check(cfg.Server.ShutdownTimeout > 0, "HTTP_SHUTDOWN_TIMEOUT must be positive")
+	for _, proxy := range cfg.Server.TrustedProxies {
+		_, _, cidrErr := net.ParseCIDR(proxy)
+		check(cidrErr == nil || net.ParseIP(proxy) != nil,
+			"HTTP_TRUSTED_PROXIES: %q is not an IP address or CIDR", proxy)
+	}
+
+	switch cfg.DB.Driver {
+	case "postgres":
+		check(cfg.DB.Host != "", "DB_HOST is required")
+		check(cfg.DB.Name != "", "DB_NAME is required")
+		check(cfg.DB.User != "", "DB_USER is required")
+		check(cfg.DB.Port > 0 && cfg.DB.Port < 65536, "DB_PORT must be a valid port, got %d", cfg.DB.Port)
+		check(sslModes[cfg.DB.SSLMode], "DB_SSLMODE %q is not a valid sslmode", cfg.DB.SSLMode)
+	case "sqlite":
+		check(cfg.DB.Path != "", "DB_PATH is required with the sqlite driver")
+	default:
+		check(false, "DB_DRIVER must be postgres or sqlite, got %q", cfg.DB.Driver)
+	}
+	check(cfg.DB.MaxOpenConns >= 0, "DB_MAX_OPEN_CONNS can't be negative")
+	check(cfg.DB.MaxIdleConns >= 0, "DB_MAX_IDLE_CONNS can't be negative")
+	check(cfg.DB.ConnMaxLifetime >= 0, "DB_CONN_MAX_LIFETIME can't be negative")
+	check(cfg.DB.ConnMaxIdleTime >= 0, "DB_CONN_MAX_IDLE_TIME can't be negative")
+
+	check(cfg.Auth.Secret != "", "SECRET is required")
+	check(cfg.Auth.AccessTokenTTL > 0, "ACCESS_TOKEN_TTL must be positive")
+	check(cfg.Auth.RefreshTokenTTL >= cfg.Auth.AccessTokenTTL, "REFRESH_TOKEN_TTL must be at least ACCESS_TOKEN_TTL")
+
+	switch cfg.Storage.Driver {
+	case "local":
+		check(cfg.Storage.Path != "", "STORAGE_PATH is required with the local driver")
+	case "s3":
+		check(cfg.Storage.S3Endpoint != "", "S3_ENDPOINT is required with the s3 driver")
+		check(cfg.Storage.S3Bucket != "", "S3_BUCKET is required with the s3 driver")
+	default:
+		check(false, "STORAGE_DRIVER must be local or s3, got %q", cfg.Storage.Driver)
+	}
+	check(cfg.Storage.ResumableDir != "", "RESUMABLE_UPLOAD_DIR is required")
+
+	check(cfg.Uploads.MaxFormMemory > 0, "UPLOAD_MAX_FORM_MEMORY must be positive")
+	check(cfg.Uploads.MaxRequestSize > 0, "UPLOAD_MAX_REQUEST_SIZE must be positive")
+	check(cfg.Uploads.MaxResumableSize > 0 && cfg.Uploads.MaxResumableSize <= MaxVideoSize,
+		"UPLOAD_MAX_RESUMABLE_SIZE must be between 1 and %d", MaxVideoSize)
+	for role, quota := range map[string]QuotaConfig{"USER": cfg.Uploads.UserQuota, "ADMIN": cfg.Uploads.AdminQuota} {
+		check(quota.MaxBytes >= 0 && quota.MaxFiles >= 0 && quota.UploadsPerHour >= 0,
+			"STORAGE_QUOTA_%s_* and UPLOAD_RATE_%s_PER_HOUR can't be negative", role, role)
+	}
+
+	check(cfg.CORS.MaxAge >= 0, "CORS_MAX_AGE can't be negative")
+	for _, origin := range cfg.CORS.AllowedOrigins {
+		check(origin != "*" || !cfg.CORS.AllowCredentials,
+			"CORS_ALLOWED_ORIGINS can't be * when CORS_ALLOW_CREDENTIALS is set")
+	}
+
+	check(logLevels[cfg.Log.Level], "LOG_LEVEL must be debug, info, warn or error, got %q", cfg.Log.Level)
+	check(cfg.Log.Format == "text" || cfg.Log.Format == "json", "LOG_FORMAT must be text or json, got %q", cfg.Log.Format)
+
+	check(cfg.Metrics.Addr == "" || cfg.Metrics.Addr != ":"+cfg.Port,
+		"METRICS_ADDR must differ from the API port, leave it empty to serve metrics there")
+	check(!cfg.Metrics.Enabled || cfg.Metrics.Addr != "" || cfg.Metrics.Token != "",
+		"METRICS_TOKEN is required to serve metrics on the API port, or set METRICS_ADDR to serve them apart")
+
+	switch cfg.Tracing.Exporter {
+	case "none", "stdout", "otlp":
+	default:
+		check(false, "TRACING_EXPORTER must be none, stdout or otlp, got %q", cfg.Tracing.Exporter)
+	}
+	check(cfg.Tracing.ServiceName != "", "OTEL_SERVICE_NAME is required")
+	check(cfg.Tracing.SampleRatio >= 0 && cfg.Tracing.SampleRatio <= 1, "TRACING_SAMPLE_RATIO must be between 0 and 1")
+
+	switch cfg.RateLimit.Store {
+	case "memory":
+	case "redis":
+		check(cfg.RateLimit.RedisURL != "", "REDIS_URL is required with the redis rate limit store")
+	default:
+		check(false, "RATE_LIMIT_STORE must be memory or redis, got %q", cfg.RateLimit.Store)
+	}
+	for group, policy := range map[string]RateLimitPolicy{
+		"AUTH": cfg.RateLimit.Auth, "TWEETS": cfg.RateLimit.Tweets,
+		"SOCIAL": cfg.RateLimit.Social, "UPLOADS": cfg.RateLimit.Uploads,
+	} {
+		check(policy.Limit >= 0 && policy.Burst >= 0,
+			"RATE_LIMIT_%s_LIMIT and RATE_LIMIT_%s_BURST can't be negative", group, group)
+		check(policy.Limit == 0 || policy.Period > 0, "RATE_LIMIT_%s_PERIOD must be positive", group)
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,227 @@
+package config
+
+import (
+	"github.com/jackc/pgx/v5/pgconn"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// setEnv runs the test in a directory without a .env or config.yaml file,
+// with the given environment.
+func setEnv(t *testing.T, env map[string]string) {
+	t.Helper()
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	t.Setenv("CONFIG_FILE", "")
+	for name, value := range env {
+		t.Setenv(name, value)
+	}
+}
+
+func TestLoadFromEnv(t *testing.T) {
+	setEnv(t, map[string]string{
+		"SECRET":                   "s3cret",
+		"DB_USER":                  "minitwitter",
+		"DB_NAME":                  "minitwitter",
+		"DB_PORT":                  "6543",
+		"ACCESS_TOKEN_TTL":         "15m",
+		"COOKIE_SECURE":            "true",
+		"HTTP_TRUSTED_PROXIES":     "10.0.0.0/8, 192.168.1.1",
+		"STORAGE_QUOTA_USER_BYTES": " 1024 ",
+		"RATE_LIMIT_SOCIAL_PERIOD": "2m",
+		"TRACING_SAMPLE_RATIO":     "0.5",
+		"REFRESH_TOKEN_TTL":        "",
+	})
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.DB.Port != 6543 || cfg.Auth.AccessTokenTTL != 15*time.Minute || !cfg.Auth.CookieSecure {
+		t.Errorf("got DB port %d, access token TTL %v and secure cookies %v",
+			cfg.DB.Port, cfg.Auth.AccessTokenTTL, cfg.Auth.CookieSecure)
+	}
+	if got := strings.Join(cfg.Server.TrustedProxies, " "); got != "10.0.0.0/8 192.168.1.1" {
+		t.Errorf("got trusted proxies %q", got)
+	}
+	if cfg.Uploads.UserQuota.MaxBytes != 1024 || cfg.RateLimit.Social.Period != 2*time.Minute {
+		t.Errorf("got user quota %+v and social rate limit %+v", cfg.Uploads.UserQuota, cfg.RateLimit.Social)
+	}
+	if cfg.Tracing.SampleRatio != 0.5 {
+		t.Errorf("got sample ratio %v, want 0.5", cfg.Tracing.SampleRatio)
+	}
+	// Empty variables keep the defaults, and the URL secret falls back to
+	// the JWT secret.
+	if cfg.Auth.RefreshTokenTTL != 24*time.Hour {
+		t.Errorf("got refresh token TTL %v, want the default", cfg.Auth.RefreshTokenTTL)
+	}
+	if cfg.Storage.URLSecret != "s3cret" {
+		t.Errorf("got URL secret %q, want the JWT secret", cfg.Storage.URLSecret)
+	}
+}
+
+func TestLoadFromYAML(t *testing.T) {
+	setEnv(t, map[string]string{"DB_NAME": "from_env"})
+
+	config := filepath.Join(t.TempDir(), "minitwitter.yaml")
+	err := os.WriteFile(config, []byte(`
+port: "3000"
+db:
+  driver: sqlite
+  path: test.db
+  name: from_yaml
+auth:
+  secret: s3cret
+  access_token_ttl: 30m
+uploads:
+  admin_quota:
+    max_files: 5
+rate_limit:
+  store: memory
+  auth:
+    limit: 3
+`), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("CONFIG_FILE", config)
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.Port != "3000" || cfg.DB.Driver != "sqlite" || cfg.Auth.AccessTokenTTL != 30*time.Minute {
+		t.Errorf("got port %q, driver %q and access token TTL %v", cfg.Port, cfg.DB.Driver, cfg.Auth.AccessTokenTTL)
+	}
+	if cfg.Uploads.AdminQuota.MaxFiles != 5 || cfg.RateLimit.Auth.Limit != 3 {
+		t.Errorf("got admin quota %+v and auth rate limit %+v", cfg.Uploads.AdminQuota, cfg.RateLimit.Auth)
+	}
+	// Settings missing from the file keep their defaults, and the
+	// environment wins over the file.
+	if cfg.RateLimit.Auth.Period != time.Minute || cfg.Log.Level != "info" {
+		t.Errorf("got auth rate limit period %v and log level %q, want the defaults", cfg.RateLimit.Auth.Period, cfg.Log.Level)
+	}
+	if cfg.DB.Name != "from_env" {
+		t.Errorf("got DB name %q, want from_env", cfg.DB.Name)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+		want string
+	}{
+		{"missing config file", map[string]string{"CONFIG_FILE": "missing.yaml"}, "reading missing.yaml"},
+		{"invalid number", map[string]string{"SECRET": "s", "DB_PORT": "five"}, "invalid DB_PORT"},
+		{"invalid duration", map[string]string{"SECRET": "s", "ACCESS_TOKEN_TTL": "10"}, "invalid ACCESS_TOKEN_TTL"},
+		{"invalid setting", map[string]string{"SECRET": "s", "DB_DRIVER": "mysql"}, "DB_DRIVER must be postgres or sqlite"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			setEnv(t, test.env)
+			_, err := Load()
+			if err == nil || !strings.Contains(err.Error(), test.want) {
+				t.Fatalf("got %v, want an error containing %q", err, test.want)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	valid := func() *Config {
+		cfg := Default()
+		cfg.DB.User = "minitwitter"
+		cfg.DB.Name = "minitwitter"
+		cfg.Auth.Secret = "s3cret"
+		return cfg
+	}
+	if err := valid().Validate(); err != nil {
+		t.Fatalf("valid config: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		change func(cfg *Config)
+		want   []string
+	}{
+		{"missing secret and database", func(cfg *Config) {
+			cfg.Auth.Secret = ""
+			cfg.DB.Name = ""
+		}, []string{"SECRET is required", "DB_NAME is required"}},
+		{"sqlite without a path", func(cfg *Config) {
+			cfg.DB.Driver = "sqlite"
+			cfg.DB.Path = ""
+		}, []string{"DB_PATH is required"}},
+		{"refresh token shorter than access token", func(cfg *Config) {
+			cfg.Auth.RefreshTokenTTL = time.Minute
+		}, []string{"REFRESH_TOKEN_TTL must be at least ACCESS_TOKEN_TTL"}},
+		{"resumable uploads larger than a video", func(cfg *Config) {
+			cfg.Uploads.MaxResumableSize = MaxVideoSize + 1
+		}, []string{"UPLOAD_MAX_RESUMABLE_SIZE must be between 1 and"}},
+		{"negative quota", func(cfg *Config) {
+			cfg.Uploads.AdminQuota.MaxFiles = -1
+		}, []string{"STORAGE_QUOTA_ADMIN_* and UPLOAD_RATE_ADMIN_PER_HOUR can't be negative"}},
+		{"credentials for any origin", func(cfg *Config) {
+			cfg.CORS.AllowedOrigins = []string{"*"}
+			cfg.CORS.AllowCredentials = true
+		}, []string{"CORS_ALLOWED_ORIGINS can't be *"}},
+		{"invalid trusted proxy", func(cfg *Config) {
+			cfg.Server.TrustedProxies = []string{"proxy.local"}
+		}, []string{`"proxy.local" is not an IP address or CIDR`}},
+		{"redis without a URL", func(cfg *Config) {
+			cfg.RateLimit.Store = "redis"
+		}, []string{"REDIS_URL is required"}},
+		{"rate limit without a period", func(cfg *Config) {
+			cfg.RateLimit.Tweets.Period = 0
+		}, []string{"RATE_LIMIT_TWEETS_PERIOD must be positive"}},
+		{"public metrics without a token", func(cfg *Config) {
+			cfg.Metrics.Enabled = true
+		}, []string{"METRICS_TOKEN is required"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg := valid()
+			test.change(cfg)
+			err := cfg.Validate()
+			if err == nil {
+				t.Fatalf("got no error, want %q", test.want)
+			}
+			for _, want := range test.want {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("got %q, want it to contain %q", err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestPostgresDSN(t *testing.T) {
+	db := Default().DB
+	db.User = "mini twitter"
+	db.Password = `it's a \secret\ sslmode=disable`
+	db.Name = ""
+	db.SSLRootCert = "/etc/ssl/root ca.pem"
+
+	// Parse the DSN as the driver does.
+	parsed, err := pgconn.ParseConfig(db.DSN())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.User != db.User || parsed.Password != db.Password || parsed.Database != "" {
+		t.Fatalf("got user %q, password %q and database %q from %s", parsed.User, parsed.Password, parsed.Database, db.DSN())
+	}
+}
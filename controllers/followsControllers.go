@@ -2,306 +2,269 @@ package controllers
 
 import (
 	"errors"
-	"fmt"
 	"github.com/gin-gonic/gin"
-	"gorm.io/gorm"
-	"main/initializers"
+	"main/apierror"
+	"main/metrics"
 	"main/models"
+	"main/repositories"
+	"main/utils"
 	"net/http"
 	"strconv"
 )
 
-func FollowUser(c *gin.Context) {
+func (h *Handler) FollowUser(c *gin.Context) {
 	id := c.Param("id")
 
 	if id == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "ID cannot be empty"})
+		c.Error(apierror.BadRequest("invalid_id", "ID cannot be empty"))
 		return
 	}
 
 	intID, err := strconv.Atoi(id)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+		c.Error(apierror.BadRequest("invalid_id", "Invalid ID format"))
 		return
 	}
 
 	user, exists := c.Get("currentUser")
 	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		c.Error(apierror.Unauthorized("unauthenticated", "User not found"))
 		return
 	}
 
 	userModel, ok := user.(models.User)
 	if !ok {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user"})
+		c.Error(apierror.Unauthorized("unauthenticated", "Invalid user"))
 		return
 	}
 
-	var followingUser models.User
-
-	err = initializers.DB.Where("id = ?", intID).First(&followingUser).Error
+	followingUser, err := h.Repos.Users.FindByID(c.Request.Context(), uint(intID))
 
 	if err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		if errors.Is(err, repositories.ErrNotFound) {
+			c.Error(apierror.NotFound("user_not_found", "User not found"))
 		} else {
-			fmt.Println(err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database query error"})
+			c.Error(apierror.Internal("Database query error", err))
 		}
 		return
 	}
 
-	var followExist models.FollowModel
-
-	errFollow := initializers.DB.Where("followed_id = ? AND following_id = ?", userModel.ID, followingUser.ID).First(&followExist).Error
-	if errFollow == nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "You are already following this user"})
-		return
-	}
-
 	if followingUser.ID == userModel.ID {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot follow yourself!"})
+		c.Error(apierror.BadRequest("self_follow", "Cannot follow yourself!"))
 		return
 	}
 
-	follow := models.FollowModel{
-		FollowingID:  followingUser.ID,
-		FollowedByID: userModel.ID,
-	}
-
-	err = initializers.DB.Create(&follow).Error
+	// Following someone twice is harmless, so it replies the same way as the
+	// first time.
+	created, err := h.Repos.Follows.Create(c.Request.Context(), userModel.ID, followingUser.ID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to follow user"})
+		c.Error(apierror.Internal("Failed to follow user", err))
 		return
 	}
+	if created {
+		metrics.Follows.Inc()
+	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "User followed successfully"})
 }
 
-func UnFollow(c *gin.Context) {
+func (h *Handler) UnFollow(c *gin.Context) {
 	id := c.Param("id")
 
 	if id == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "ID cannot be empty"})
+		c.Error(apierror.BadRequest("invalid_id", "ID cannot be empty"))
 		return
 	}
 
 	intID, err := strconv.Atoi(id)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+		c.Error(apierror.BadRequest("invalid_id", "Invalid ID format"))
 		return
 	}
 
 	user, exists := c.Get("currentUser")
 	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		c.Error(apierror.Unauthorized("unauthenticated", "User not found"))
 		return
 	}
 
 	userModel, ok := user.(models.User)
 	if !ok {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user"})
+		c.Error(apierror.Unauthorized("unauthenticated", "Invalid user"))
 		return
 	}
 
-	var followingUser models.User
-	err = initializers.DB.Where("id = ?", intID).First(&followingUser).Error
+	followingUser, err := h.Repos.Users.FindByID(c.Request.Context(), uint(intID))
 	if err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		if errors.Is(err, repositories.ErrNotFound) {
+			c.Error(apierror.NotFound("user_not_found", "User not found"))
 		} else {
-			fmt.Println(err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database query error"})
+			c.Error(apierror.Internal("Database query error", err))
 		}
 		return
 	}
 
-	var followExist models.FollowModel
-	errFollow := initializers.DB.Where("followed_by_id = ? AND following_id = ?", followingUser.ID, userModel.ID).First(&followExist).Error
-	if errFollow == nil {
-		if err = initializers.DB.Delete(&followExist).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unfollow"})
-			return
-		}
-	} else if errors.Is(errFollow, gorm.ErrRecordNotFound) {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Not following this user"})
+	deleted, err := h.Repos.Follows.Delete(c.Request.Context(), userModel.ID, followingUser.ID)
+	if err != nil {
+		c.Error(apierror.Internal("Failed to unfollow", err))
 		return
-	} else {
-		fmt.Println(errFollow)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database query error"})
+	}
+	if !deleted {
+		c.Error(apierror.NotFound("not_following", "Not following this user"))
 		return
 	}
 
-	c.JSON(http.StatusNoContent, gin.H{"message": "Unfollowed successfully"})
+	c.Status(http.StatusNoContent)
 }
 
-func ListFollowers(c *gin.Context) {
+// ListFollowers lists the users who follow the current user.
+func (h *Handler) ListFollowers(c *gin.Context) {
 	user, exists := c.Get("currentUser")
 	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		c.Error(apierror.Unauthorized("unauthenticated", "User not found"))
 		return
 	}
 
 	currentUser, ok := user.(models.User)
 	if !ok {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user"})
+		c.Error(apierror.Unauthorized("unauthenticated", "Invalid user"))
 		return
 	}
 
-	var followers []models.User
-	err := initializers.DB.Model(&models.FollowModel{}).
-		Where("followed_by_id = ?", currentUser.ID).
-		Joins("JOIN users ON users.id = follow_models.following_id").
-		Find(&followers).Error
+	followers, err := h.Repos.Follows.Followers(c.Request.Context(), currentUser.ID)
 
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve followers"})
+		c.Error(apierror.Internal("Failed to retrieve followers", err))
 		return
 	}
 
+	response := make([]utils.PublicUserResponse, 0, len(followers))
+	for _, follower := range followers {
+		response = append(response, h.publicUser(c.Request.Context(), follower))
+	}
+
 	c.JSON(http.StatusOK, gin.H{
-		"followers": followers,
+		"followers": response,
 	})
 }
 
-func ListFollowings(c *gin.Context) {
+// ListFollowings lists the users the current user follows.
+func (h *Handler) ListFollowings(c *gin.Context) {
 	user, exists := c.Get("currentUser")
 	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		c.Error(apierror.Unauthorized("unauthenticated", "User not found"))
 		return
 	}
 
 	currentUser, ok := user.(models.User)
 	if !ok {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user"})
+		c.Error(apierror.Unauthorized("unauthenticated", "Invalid user"))
 		return
 	}
 
-	var followings []models.User
-	err := initializers.DB.Model(&models.FollowModel{}).
-		Where("following_id = ?", currentUser.ID).
-		Joins("JOIN users ON users.id = follow_models.followed_by_id").
-		Find(&followings).Error
+	followings, err := h.Repos.Follows.Followings(c.Request.Context(), currentUser.ID)
 
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve followings"})
+		c.Error(apierror.Internal("Failed to retrieve followings", err))
 		return
 	}
 
+	response := make([]utils.PublicUserResponse, 0, len(followings))
+	for _, following := range followings {
+		response = append(response, h.publicUser(c.Request.Context(), following))
+	}
+
 	c.JSON(http.StatusOK, gin.H{
-		"followings": followings,
+		"followings": response,
 	})
 }
 
-func LikeTweet(c *gin.Context) {
+func (h *Handler) LikeTweet(c *gin.Context) {
 	id := c.Param("id")
 
 	if id == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "ID cannot be empty"})
+		c.Error(apierror.BadRequest("invalid_id", "ID cannot be empty"))
 		return
 	}
 
 	intID, err := strconv.Atoi(id)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+		c.Error(apierror.BadRequest("invalid_id", "Invalid ID format"))
 		return
 	}
 
 	user, exists := c.Get("currentUser")
 	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		c.Error(apierror.Unauthorized("unauthenticated", "User not found"))
 		return
 	}
 
 	userModel, ok := user.(models.User)
 	if !ok {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user"})
+		c.Error(apierror.Unauthorized("unauthenticated", "Invalid user"))
 		return
 	}
 
-	var tweet models.Tweet
-	err = initializers.DB.Where("id = ?", intID).First(&tweet).Error
+	tweet, err := h.Repos.Tweets.FindByID(c.Request.Context(), uint(intID))
 	if err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Tweet not found"})
+		if errors.Is(err, repositories.ErrNotFound) {
+			c.Error(apierror.NotFound("tweet_not_found", "Tweet not found"))
 		} else {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database query error"})
+			c.Error(apierror.Internal("Database query error", err))
 		}
 		return
 	}
 
-	var like models.LikeModel
-	err = initializers.DB.Where("user_id = ? AND tweet_id = ?", userModel.ID, tweet.ID).First(&like).Error
-
-	if err == nil {
-		// Like already exists, so return an error
-		c.JSON(http.StatusConflict, gin.H{"error": "Tweet already liked"})
+	created, err := h.Repos.Likes.Create(c.Request.Context(), userModel.ID, tweet.ID)
+	if err != nil {
+		c.Error(apierror.Internal("Failed to like tweet", err))
 		return
 	}
-
-	// Create the like
-	like = models.LikeModel{
-		UserID:  userModel.ID,
-		TweetID: tweet.ID,
-	}
-
-	if err := initializers.DB.Create(&like).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to like tweet"})
-		return
+	if created {
+		metrics.Likes.Inc()
 	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "Tweet liked successfully"})
 }
 
-func UnlikeTweet(c *gin.Context) {
+func (h *Handler) UnlikeTweet(c *gin.Context) {
 	id := c.Param("id")
 
 	if id == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "ID cannot be empty"})
+		c.Error(apierror.BadRequest("invalid_id", "ID cannot be empty"))
 		return
 	}
 
 	intID, err := strconv.Atoi(id)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+		c.Error(apierror.BadRequest("invalid_id", "Invalid ID format"))
 		return
 	}
 
 	user, exists := c.Get("currentUser")
 	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		c.Error(apierror.Unauthorized("unauthenticated", "User not found"))
 		return
 	}
 
 	userModel, ok := user.(models.User)
 	if !ok {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user"})
+		c.Error(apierror.Unauthorized("unauthenticated", "Invalid user"))
 		return
 	}
 
-	var tweet models.Tweet
-	err = initializers.DB.Where("id = ?", intID).First(&tweet).Error
+	tweet, err := h.Repos.Tweets.FindByID(c.Request.Context(), uint(intID))
 	if err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Tweet not found"})
+		if errors.Is(err, repositories.ErrNotFound) {
+			c.Error(apierror.NotFound("tweet_not_found", "Tweet not found"))
 		} else {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database query error"})
+			c.Error(apierror.Internal("Database query error", err))
 		}
 		return
 	}
 
-	var like models.LikeModel
-	err = initializers.DB.Where("user_id = ? AND tweet_id = ?", userModel.ID, tweet.ID).First(&like).Error
-
-	if errors.Is(err, gorm.ErrRecordNotFound) {
-		// Like does not exist, so return an error
-		c.JSON(http.StatusNotFound, gin.H{"error": "Like not found"})
-		return
-	}
-
-	// Delete the like
-	if err := initializers.DB.Delete(&like).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unlike tweet"})
+	if _, err := h.Repos.Likes.Delete(c.Request.Context(), userModel.ID, tweet.ID); err != nil {
+		c.Error(apierror.Internal("Failed to unlike tweet", err))
 		return
 	}
 
@@ -0,0 +1,98 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"main/middlewares"
+	"main/models"
+	"main/ratelimit"
+	"main/storage"
+	"main/testdb"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestFollowDirection(t *testing.T) {
+	cfg := testdb.Config()
+	db := testdb.Open(t)
+	signer := storage.NewURLSigner("secret", "http://localhost")
+	h := NewHandler(db, cfg, storage.NewLocalStorage(t.TempDir(), signer), signer, ratelimit.NewMemoryStore())
+
+	users := map[string]models.User{}
+	for _, name := range []string{"alice", "bob"} {
+		user := models.User{UserName: name, Email: name + "@example.com", Password: "x", Role: models.RoleUser}
+		if err := db.Create(&user).Error; err != nil {
+			t.Fatal(err)
+		}
+		users[name] = user
+	}
+	alice, bob := users["alice"], users["bob"]
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(middlewares.Errors())
+	auth := func(c *gin.Context) { c.Set("currentUser", users[c.GetHeader("X-User")]) }
+	r.POST("/follow/:id", auth, h.FollowUser)
+	r.POST("/unfollow/:id", auth, h.UnFollow)
+	r.GET("/followers", auth, h.ListFollowers)
+	r.GET("/followings", auth, h.ListFollowings)
+
+	serve := func(as, method, path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("X-User", as)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	// list returns the names of the users listed under key by GET path.
+	list := func(as, path, key string) []string {
+		w := serve(as, http.MethodGet, path)
+		if w.Code != http.StatusOK {
+			t.Fatalf("GET %s as %s: got %d: %s", path, as, w.Code, w.Body)
+		}
+		var body map[string][]struct {
+			UserName string `json:"username"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Fatal(err)
+		}
+		names := []string{}
+		for _, user := range body[key] {
+			names = append(names, user.UserName)
+		}
+		return names
+	}
+
+	// alice follows bob.
+	if w := serve("alice", http.MethodPost, fmt.Sprintf("/follow/%d", bob.ID)); w.Code != http.StatusOK {
+		t.Fatalf("follow: got %d: %s", w.Code, w.Body)
+	}
+
+	tests := []struct {
+		as, path string
+		want     string
+	}{
+		{"bob", "/followers", "[alice]"},
+		{"bob", "/followings", "[]"},
+		{"alice", "/followers", "[]"},
+		{"alice", "/followings", "[bob]"},
+	}
+	for _, test := range tests {
+		if got := fmt.Sprint(list(test.as, test.path, test.path[1:])); got != test.want {
+			t.Errorf("GET %s as %s: got %s, want %s", test.path, test.as, got, test.want)
+		}
+	}
+
+	// Only alice can undo her follow.
+	if w := serve("bob", http.MethodPost, fmt.Sprintf("/unfollow/%d", alice.ID)); w.Code != http.StatusNotFound {
+		t.Fatalf("bob unfollowing alice: got %d, want 404", w.Code)
+	}
+	if w := serve("alice", http.MethodPost, fmt.Sprintf("/unfollow/%d", bob.ID)); w.Code != http.StatusNoContent {
+		t.Fatalf("alice unfollowing bob: got %d, want 204", w.Code)
+	}
+	if got := list("bob", "/followers", "followers"); len(got) != 0 {
+		t.Fatalf("followers of bob after unfollowing: got %v, want none", got)
+	}
+}
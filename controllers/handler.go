@@ -0,0 +1,46 @@
+package controllers
+
+import (
+	"gorm.io/gorm"
+	"main/blobs"
+	"main/config"
+	"main/ratelimit"
+	"main/repositories"
+	"main/search"
+	"main/storage"
+	"sync/atomic"
+)
+
+// Handler serves the HTTP API. Every dependency is injected through its
+// fields, so tests can build one around a throwaway database and storage.
+type Handler struct {
+	DB      *gorm.DB
+	Repos   *repositories.Repositories
+	Config  *config.Config
+	Storage storage.Storage
+	Signer  *storage.URLSigner
+	Blobs   *blobs.Service
+	Search  *search.Service
+	// RateLimits holds the hourly upload limits of users.
+	RateLimits ratelimit.Store
+
+	// resumableLocks serializes the requests to each upload so two chunks
+	// are never appended to the same partial file at once.
+	resumableLocks uploadLocks
+
+	// draining is set once shutdown started, see Drain.
+	draining atomic.Bool
+}
+
+func NewHandler(db *gorm.DB, cfg *config.Config, store storage.Storage, signer *storage.URLSigner, limits ratelimit.Store) *Handler {
+	return &Handler{
+		DB:         db,
+		Repos:      repositories.New(db),
+		Config:     cfg,
+		Storage:    store,
+		Signer:     signer,
+		Blobs:      blobs.New(db, store),
+		Search:     search.New(db),
+		RateLimits: limits,
+	}
+}
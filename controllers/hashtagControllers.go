@@ -0,0 +1,87 @@
+package controllers
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"main/apierror"
+	"main/jobs"
+	"main/models"
+	"main/utils"
+	"net/http"
+)
+
+func (h *Handler) HashtagTweets(c *gin.Context) {
+	tag := utils.NormalizeHashtag(c.Param("tag"))
+
+	page, ok := parsePage(c)
+	if !ok {
+		return
+	}
+
+	var hashtag models.Hashtag
+	err := h.DB.WithContext(c.Request.Context()).Where("name = ?", tag).First(&hashtag).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.Error(apierror.NotFound("hashtag_not_found", "Hashtag not found"))
+		} else {
+			c.Error(apierror.Internal("Database query error", err))
+		}
+		return
+	}
+
+	var tweets []models.Tweet
+	err = page.scope(h.DB.WithContext(c.Request.Context()).
+		Joins("JOIN tweet_hashtags ON tweet_hashtags.tweet_id = tweets.id AND tweet_hashtags.deleted_at IS NULL").
+		Where("tweet_hashtags.hashtag_id = ?", hashtag.ID), "tweets").
+		Find(&tweets).Error
+	if err != nil {
+		c.Error(apierror.Internal("Database query error", err))
+		return
+	}
+	tweets, next := nextPage(page, tweets, tweetID)
+
+	response, err := h.tweetResponses(c.Request.Context(), tweets)
+	if err != nil {
+		c.Error(apierror.Internal("Failed to load tweets", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"hashtag":     hashtag.Name,
+		"tweets":      response,
+		"next_cursor": next,
+	})
+}
+
+func (h *Handler) Trends(c *gin.Context) {
+	window, ok := jobs.FindTrendWindow(c.DefaultQuery("window", jobs.TrendWindows[0].Name))
+	if !ok {
+		c.Error(apierror.BadRequest("invalid_window", "Invalid trend window"))
+		return
+	}
+
+	var trends []models.Trend
+	err := h.DB.WithContext(c.Request.Context()).Preload("Hashtag").
+		Where("trend_window = ?", window.Name).
+		Order("score DESC").
+		Find(&trends).Error
+	if err != nil {
+		c.Error(apierror.Internal("Database query error", err))
+		return
+	}
+
+	response := make([]utils.TrendResponse, 0, len(trends))
+	for _, trend := range trends {
+		response = append(response, utils.TrendResponse{
+			Hashtag: trend.Hashtag.Name,
+			Count:   trend.Count,
+			Score:   trend.Score,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"window": window.Name,
+		"trends": response,
+	})
+}
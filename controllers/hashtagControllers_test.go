@@ -0,0 +1,89 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"main/middlewares"
+	"main/models"
+	"main/ratelimit"
+	"main/storage"
+	"main/testdb"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHashtagTweetsPages(t *testing.T) {
+	cfg := testdb.Config()
+	db := testdb.Open(t)
+	signer := storage.NewURLSigner("secret", "http://localhost")
+	h := NewHandler(db, cfg, storage.NewLocalStorage(t.TempDir(), signer), signer, ratelimit.NewMemoryStore())
+
+	author := models.User{UserName: "author", Email: "author@example.com", Password: "x", Role: models.RoleUser}
+	if err := db.Create(&author).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	// Two tweets share each timestamp, so pages must break ties by ID.
+	start := time.Now().Add(-time.Hour).Truncate(time.Second)
+	var want []uint
+	for i := 0; i < 5; i++ {
+		tweet := models.Tweet{Title: "tweet", Body: fmt.Sprintf("#golang number %d", i), AuthorID: author.ID}
+		tweet.CreatedAt = start.Add(time.Duration(i/2) * time.Minute)
+		if err := db.Create(&tweet).Error; err != nil {
+			t.Fatal(err)
+		}
+		if err := h.Search.Index(context.Background(), tweet); err != nil {
+			t.Fatal(err)
+		}
+		want = append([]uint{tweet.ID}, want...)
+	}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(middlewares.Errors())
+	r.GET("/hashtags/:tag/tweets", h.HashtagTweets)
+
+	var got []uint
+	path := "/hashtags/golang/tweets?limit=2"
+	for pages := 0; ; pages++ {
+		if pages == 3 {
+			t.Fatalf("more than 3 pages of 2 for 5 tweets")
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("GET %s: got %d: %s", path, w.Code, w.Body)
+		}
+
+		var page struct {
+			Tweets []struct {
+				ID uint `json:"id"`
+			} `json:"tweets"`
+			NextCursor *uint `json:"next_cursor"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &page); err != nil {
+			t.Fatal(err)
+		}
+		for _, tweet := range page.Tweets {
+			got = append(got, tweet.ID)
+		}
+		if page.NextCursor == nil {
+			break
+		}
+		path = fmt.Sprintf("/hashtags/golang/tweets?limit=2&before=%d", *page.NextCursor)
+	}
+
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("got tweets %v, want %v", got, want)
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/hashtags/golang/tweets?limit=1000", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("limit over the maximum: got %d, want 400", w.Code)
+	}
+}
@@ -0,0 +1,68 @@
+package controllers
+
+import (
+	"context"
+	"github.com/gin-gonic/gin"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// readyTimeout bounds each readiness check, so a hung dependency fails the
+// probe instead of stalling it.
+const readyTimeout = 2 * time.Second
+
+// Drain makes the readiness probe fail from now on, so the orchestrator stops
+// routing new requests here while the server shuts down.
+func (h *Handler) Drain() {
+	h.draining.Store(true)
+}
+
+// Healthz is the liveness probe. It only tells the process is serving
+// requests, failing dependencies are reported by Readyz.
+func (h *Handler) Healthz(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// Readyz is the readiness probe. It checks the database and the storage
+// backend, and fails while the server is draining.
+func (h *Handler) Readyz(c *gin.Context) {
+	if h.draining.Load() {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"status": "shutting down"})
+		return
+	}
+
+	checks := map[string]func(ctx context.Context) error{
+		"database": func(ctx context.Context) error {
+			sqlDB, err := h.DB.DB()
+			if err != nil {
+				return err
+			}
+			return sqlDB.PingContext(ctx)
+		},
+		"storage": h.Storage.Ping,
+	}
+
+	status, results := http.StatusOK, gin.H{}
+	for name, check := range checks {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), readyTimeout)
+		err := check(ctx)
+		cancel()
+
+		if err != nil {
+			// The details stay in the logs, the probe may be reachable from
+			// outside.
+			slog.ErrorContext(c.Request.Context(), "Readiness check failed", "check", name, "error", err)
+			status = http.StatusServiceUnavailable
+			results[name] = "failing"
+		} else {
+			results[name] = "ok"
+		}
+	}
+
+	if status == http.StatusOK {
+		c.JSON(status, gin.H{"status": "ok", "checks": results})
+	} else {
+		c.JSON(status, gin.H{"status": "unavailable", "checks": results})
+	}
+}
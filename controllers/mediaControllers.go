@@ -0,0 +1,346 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"io"
+	"log/slog"
+	"main/apierror"
+	"main/config"
+	"main/metrics"
+	"main/models"
+	"main/utils"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	maxTweetImages = 4
+	maxTweetVideos = 1
+)
+
+var errUnsupportedMedia = errors.New("only images and videos can be uploaded")
+
+// mediaError is a media validation failure that can be shown to the client.
+type mediaError struct {
+	message string
+}
+
+func (e *mediaError) Error() string {
+	return e.message
+}
+
+func (h *Handler) UploadMedia(c *gin.Context) {
+	user, exists := c.Get("currentUser")
+	if !exists {
+		c.Error(apierror.Unauthorized("unauthenticated", "User not found"))
+		return
+	}
+
+	userModel, ok := user.(models.User)
+	if !ok {
+		c.Error(apierror.Unauthorized("unauthenticated", "Invalid user"))
+		return
+	}
+
+	file, err := c.FormFile("file")
+	if err != nil {
+		c.Error(apierror.BadRequest("file_required", "File is required"))
+		return
+	}
+
+	if !h.checkUpload(c, userModel, file.Size, false) {
+		return
+	}
+
+	media, err := h.saveMedia(c.Request.Context(), userModel.ID, file, c.Request.FormValue("alt_text"))
+	if err != nil {
+		abortWithMediaError(c, err)
+		return
+	}
+	h.countUpload(c.Request.Context(), userModel)
+
+	c.JSON(http.StatusOK, gin.H{"media": h.mediaResponse(c.Request.Context(), media)})
+}
+
+// saveMedia stores an uploaded file as media, see storeMedia.
+func (h *Handler) saveMedia(ctx context.Context, ownerID uint, file *multipart.FileHeader, altText string) (models.Media, error) {
+	src, err := file.Open()
+	if err != nil {
+		return models.Media{}, err
+	}
+	defer src.Close()
+
+	media, err := h.storeMedia(ctx, ownerID, src, file.Size, file.Filename, altText)
+	if err != nil {
+		return models.Media{}, err
+	}
+	metrics.UploadBytes.WithLabelValues("form").Add(float64(file.Size))
+	return media, nil
+}
+
+// storeMedia stores an uploaded image or video and creates its unattached
+// Media row. Images are re-encoded and get resized variants, videos are
+// stored as is.
+func (h *Handler) storeMedia(ctx context.Context, ownerID uint, src io.ReadSeeker, size int64, fileName, altText string) (models.Media, error) {
+	header := make([]byte, 512)
+	n, err := io.ReadFull(src, header)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return models.Media{}, err
+	}
+	if _, err := src.Seek(0, io.SeekStart); err != nil {
+		return models.Media{}, err
+	}
+	header = header[:n]
+	mimeType := http.DetectContentType(header)
+
+	media := models.Media{
+		OwnerID:  ownerID,
+		MimeType: mimeType,
+		Size:     size,
+		AltText:  altText,
+	}
+
+	switch {
+	case strings.HasPrefix(mimeType, "image/"):
+		filePath, img, err := h.storeImage(ctx, src, utils.TweetMediaVariants)
+		if err != nil {
+			return models.Media{}, err
+		}
+		media.Kind = models.MediaKindImage
+		media.Path = filePath
+		media.MimeType = img.MimeType
+		media.Size = int64(len(img.Data))
+		media.Width = img.Width
+		media.Height = img.Height
+	case utils.IsVideoHeader(header):
+		if err := h.storeVideo(ctx, src, header, &media); err != nil {
+			return models.Media{}, err
+		}
+	default:
+		return models.Media{}, errUnsupportedMedia
+	}
+
+	if err := h.DB.WithContext(ctx).Create(&media).Error; err != nil {
+		h.releaseFile(ctx, media.Path)
+		h.releaseFile(ctx, media.PosterPath)
+		return models.Media{}, err
+	}
+
+	return media, nil
+}
+
+// storeVideo checks that src is an MP4 or WebM video within the size and
+// duration limits and stores it. Duration, dimensions and a poster frame are
+// extracted with ffprobe/ffmpeg when they are installed; without them the
+// video is stored without that metadata and the duration can't be enforced.
+func (h *Handler) storeVideo(ctx context.Context, src io.ReadSeeker, header []byte, media *models.Media) error {
+	mimeType, ext, ok := utils.SniffVideo(header)
+	if !ok {
+		return utils.ErrUnsupportedVideo
+	}
+	if media.Size > config.MaxVideoSize {
+		return utils.ErrVideoTooLarge
+	}
+
+	// ffprobe needs a file on disk, and src may only be in memory.
+	tmp, err := os.CreateTemp("", "video-*"+ext)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	size, err := io.Copy(tmp, io.LimitReader(src, config.MaxVideoSize+1))
+	if err != nil {
+		return err
+	}
+	if size > config.MaxVideoSize {
+		return utils.ErrVideoTooLarge
+	}
+
+	media.Kind = models.MediaKindVideo
+	media.MimeType = mimeType
+	media.Size = size
+
+	info, err := utils.ProbeVideo(ctx, tmp.Name())
+	switch {
+	case errors.Is(err, utils.ErrFFmpegUnavailable):
+		slog.WarnContext(ctx, "ffprobe not found, storing video without metadata")
+	case err != nil:
+		return err
+	default:
+		if info.Duration > utils.MaxVideoDuration {
+			return utils.ErrVideoTooLong
+		}
+		media.DurationMs = info.Duration.Milliseconds()
+		media.Width = info.Width
+		media.Height = info.Height
+
+		poster, err := utils.ExtractPosterFrame(ctx, tmp.Name(), info.Duration)
+		if err == nil {
+			media.PosterPath, _, err = h.storeImage(ctx, bytes.NewReader(poster), utils.TweetMediaVariants)
+		}
+		if err != nil {
+			slog.WarnContext(ctx, "Failed to extract poster frame", "error", err)
+		}
+	}
+
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	media.Path, err = h.Blobs.Store(ctx, tmp, ext, mimeType)
+	if err != nil {
+		h.releaseFile(ctx, media.PosterPath)
+		return err
+	}
+
+	return nil
+}
+
+// abortWithMediaError records the error of a failed storeMedia call.
+func abortWithMediaError(c *gin.Context, err error) {
+	if errors.Is(err, errUnsupportedMedia) {
+		c.Error(apierror.New(http.StatusUnsupportedMediaType, "unsupported_media_type", err.Error()))
+		return
+	}
+	if status := utils.VideoErrorStatus(err); status != 0 {
+		c.Error(apierror.New(status, fileErrorCode(status), err.Error()))
+		return
+	}
+	abortWithImageError(c, err)
+}
+
+// parseMediaIDs reads the media_ids form field, accepting both repeated
+// fields and a comma separated list.
+func parseMediaIDs(c *gin.Context) ([]uint, error) {
+	var ids []uint
+	for _, value := range c.Request.Form["media_ids"] {
+		for _, part := range strings.Split(value, ",") {
+			part = strings.TrimSpace(part)
+			if part == "" {
+				continue
+			}
+			id, err := strconv.ParseUint(part, 10, 64)
+			if err != nil {
+				return nil, &mediaError{message: "Invalid media ID format"}
+			}
+			ids = append(ids, uint(id))
+		}
+	}
+	return ids, nil
+}
+
+// findAttachableMedia loads the given uploads of a user and checks that they
+// can be attached to one tweet: at most four images, or a single video.
+func (h *Handler) findAttachableMedia(ctx context.Context, ownerID uint, ids []uint) ([]models.Media, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	var found []models.Media
+	err := h.DB.WithContext(ctx).Where("id IN ? AND owner_id = ? AND tweet_id IS NULL", ids, ownerID).Find(&found).Error
+	if err != nil {
+		return nil, err
+	}
+
+	byID := make(map[uint]models.Media, len(found))
+	for _, media := range found {
+		byID[media.ID] = media
+	}
+
+	media := make([]models.Media, 0, len(ids))
+	var images, videos int
+	for _, id := range ids {
+		item, ok := byID[id]
+		if !ok {
+			return nil, &mediaError{message: fmt.Sprintf("Media %d not found or already attached", id)}
+		}
+		delete(byID, id)
+
+		switch item.Kind {
+		case models.MediaKindImage:
+			images++
+		case models.MediaKindVideo:
+			videos++
+		}
+		media = append(media, item)
+	}
+
+	if videos > maxTweetVideos || (videos > 0 && images > 0) {
+		return nil, &mediaError{message: "A tweet can have only one video and no images alongside it"}
+	}
+	if images > maxTweetImages {
+		return nil, &mediaError{message: fmt.Sprintf("A tweet can have at most %d images", maxTweetImages)}
+	}
+
+	return media, nil
+}
+
+// loadMediaResponses returns the attached media of the given tweets keyed by
+// tweet ID.
+func (h *Handler) loadMediaResponses(ctx context.Context, tweetIDs []uint) (map[uint][]utils.MediaResponse, error) {
+	responses := make(map[uint][]utils.MediaResponse)
+	if len(tweetIDs) == 0 {
+		return responses, nil
+	}
+
+	var media []models.Media
+	err := h.DB.WithContext(ctx).Where("tweet_id IN ?", tweetIDs).Order("position").Find(&media).Error
+	if err != nil {
+		return nil, err
+	}
+
+	for _, item := range media {
+		responses[*item.TweetID] = append(responses[*item.TweetID], h.mediaResponse(ctx, item))
+	}
+
+	return responses, nil
+}
+
+func (h *Handler) mediaResponse(ctx context.Context, media models.Media) utils.MediaResponse {
+	response := utils.MediaResponse{
+		ID:       media.ID,
+		Kind:     media.Kind,
+		File:     h.fileURL(ctx, media.Path),
+		MimeType: media.MimeType,
+		Size:     media.Size,
+		Width:    media.Width,
+		Height:   media.Height,
+		AltText:  media.AltText,
+	}
+	if media.Kind == models.MediaKindImage {
+		response.Variants = h.variantURLs(ctx, media.Path, utils.TweetMediaVariants)
+	}
+	if media.Kind == models.MediaKindVideo {
+		response.DurationMs = media.DurationMs
+		response.Poster = h.fileURL(ctx, media.PosterPath)
+		response.PosterVariants = h.variantURLs(ctx, media.PosterPath, utils.TweetMediaVariants)
+	}
+	return response
+}
+
+// videoResponse returns the video of a tweet, if it has one, from its media.
+func videoResponse(media []utils.MediaResponse) *utils.VideoResponse {
+	for _, item := range media {
+		if item.Kind != models.MediaKindVideo {
+			continue
+		}
+		return &utils.VideoResponse{
+			URL:            item.File,
+			MimeType:       item.MimeType,
+			DurationMs:     item.DurationMs,
+			Width:          item.Width,
+			Height:         item.Height,
+			Poster:         item.Poster,
+			PosterVariants: item.PosterVariants,
+		}
+	}
+	return nil
+}
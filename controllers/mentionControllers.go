@@ -0,0 +1,79 @@
+package controllers
+
+import (
+	"context"
+	"github.com/gin-gonic/gin"
+	"main/apierror"
+	"main/models"
+	"main/utils"
+	"net/http"
+)
+
+// loadMentionEntities returns the mention entities of the given tweets keyed
+// by tweet ID.
+func (h *Handler) loadMentionEntities(ctx context.Context, tweetIDs []uint) (map[uint][]utils.MentionEntity, error) {
+	entities := make(map[uint][]utils.MentionEntity)
+	if len(tweetIDs) == 0 {
+		return entities, nil
+	}
+
+	var mentions []models.Mention
+	err := h.DB.WithContext(ctx).Preload("User").
+		Where("tweet_id IN ?", tweetIDs).
+		Order("start_offset").
+		Find(&mentions).Error
+	if err != nil {
+		return nil, err
+	}
+
+	for _, mention := range mentions {
+		entities[mention.TweetID] = append(entities[mention.TweetID], utils.MentionEntity{
+			UserID:   mention.UserID,
+			UserName: mention.User.UserName,
+			Start:    mention.Start,
+			End:      mention.End,
+		})
+	}
+
+	return entities, nil
+}
+
+func (h *Handler) ListMentions(c *gin.Context) {
+	user, exists := c.Get("currentUser")
+	if !exists {
+		c.Error(apierror.Unauthorized("unauthenticated", "User not found"))
+		return
+	}
+
+	currentUser, ok := user.(models.User)
+	if !ok {
+		c.Error(apierror.Unauthorized("unauthenticated", "Invalid user"))
+		return
+	}
+
+	page, ok := parsePage(c)
+	if !ok {
+		return
+	}
+
+	var tweets []models.Tweet
+	err := page.scope(h.DB.WithContext(c.Request.Context()).
+		Where("id IN (?)", h.DB.WithContext(c.Request.Context()).Model(&models.Mention{}).Select("tweet_id").Where("user_id = ?", currentUser.ID)), "tweets").
+		Find(&tweets).Error
+	if err != nil {
+		c.Error(apierror.Internal("Failed to retrieve mentions", err))
+		return
+	}
+	tweets, next := nextPage(page, tweets, tweetID)
+
+	response, err := h.tweetResponses(c.Request.Context(), tweets)
+	if err != nil {
+		c.Error(apierror.Internal("Failed to retrieve mentions", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"mentions":    response,
+		"next_cursor": next,
+	})
+}
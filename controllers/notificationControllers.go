@@ -0,0 +1,86 @@
+package controllers
+
+import (
+	"github.com/gin-gonic/gin"
+	"main/apierror"
+	"main/models"
+	"main/utils"
+	"net/http"
+	"time"
+)
+
+// ListNotifications returns the notifications of the current user, newest
+// first. Those about tweets deleted since are left out.
+func (h *Handler) ListNotifications(c *gin.Context) {
+	user, exists := c.Get("currentUser")
+	if !exists {
+		c.Error(apierror.Unauthorized("unauthenticated", "User not found"))
+		return
+	}
+
+	currentUser, ok := user.(models.User)
+	if !ok {
+		c.Error(apierror.Unauthorized("unauthenticated", "Invalid user"))
+		return
+	}
+
+	page, ok := parsePage(c)
+	if !ok {
+		return
+	}
+
+	var notifications []models.Notification
+	err := page.scope(h.DB.WithContext(c.Request.Context()).Preload("Actor").
+		Joins("JOIN tweets ON tweets.id = notifications.tweet_id AND tweets.deleted_at IS NULL").
+		Where("notifications.user_id = ?", currentUser.ID), "notifications").
+		Find(&notifications).Error
+	if err != nil {
+		c.Error(apierror.Internal("Failed to retrieve notifications", err))
+		return
+	}
+	notifications, next := nextPage(page, notifications, func(n models.Notification) uint { return n.ID })
+
+	response := make([]utils.NotificationResponse, 0, len(notifications))
+	for _, notification := range notifications {
+		response = append(response, utils.NotificationResponse{
+			ID:            notification.ID,
+			Kind:          notification.Kind,
+			ActorID:       notification.ActorID,
+			ActorUserName: notification.Actor.UserName,
+			TweetID:       notification.TweetID,
+			CreatedAt:     notification.CreatedAt.Format(time.RFC3339),
+			Read:          notification.ReadAt != nil,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"notifications": response,
+		"next_cursor":   next,
+	})
+}
+
+// MarkNotificationsRead marks every notification of the current user as
+// read.
+func (h *Handler) MarkNotificationsRead(c *gin.Context) {
+	user, exists := c.Get("currentUser")
+	if !exists {
+		c.Error(apierror.Unauthorized("unauthenticated", "User not found"))
+		return
+	}
+
+	currentUser, ok := user.(models.User)
+	if !ok {
+		c.Error(apierror.Unauthorized("unauthenticated", "Invalid user"))
+		return
+	}
+
+	err := h.DB.WithContext(c.Request.Context()).Model(&models.Notification{}).
+		Where("user_id = ? AND read_at IS NULL", currentUser.ID).
+		Update("read_at", time.Now()).Error
+	if err != nil {
+		c.Error(apierror.Internal("Failed to update notifications", err))
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
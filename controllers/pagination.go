@@ -0,0 +1,72 @@
+package controllers
+
+import (
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"main/apierror"
+	"main/models"
+	"strconv"
+)
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+// page is a page of a list, newest first. Pages are chained with the before
+// parameter, the ID of the last item of the previous page, which stays
+// correct while new items are added.
+type page struct {
+	Limit  int
+	Before uint
+}
+
+// parsePage reads the limit and before query parameters. It records an
+// error and returns false when they are invalid.
+func parsePage(c *gin.Context) (page, bool) {
+	p := page{Limit: defaultPageSize}
+
+	if value := c.Query("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxPageSize {
+			c.Error(apierror.BadRequest("invalid_limit", "limit must be between 1 and "+strconv.Itoa(maxPageSize)))
+			return p, false
+		}
+		p.Limit = limit
+	}
+
+	if value := c.Query("before"); value != "" {
+		before, err := strconv.ParseUint(value, 10, 0)
+		if err != nil {
+			c.Error(apierror.BadRequest("invalid_cursor", "before must be an ID"))
+			return p, false
+		}
+		p.Before = uint(before)
+	}
+
+	return p, true
+}
+
+// scope orders a query of table newest first and restricts it to the page.
+// It fetches one extra row so nextPage can tell whether there are more.
+func (p page) scope(tx *gorm.DB, table string) *gorm.DB {
+	if p.Before != 0 {
+		tx = tx.Where("("+table+".created_at, "+table+".id) < (SELECT created_at, id FROM "+table+" WHERE id = ?)", p.Before)
+	}
+	return tx.Order(table + ".created_at DESC, " + table + ".id DESC").Limit(p.Limit + 1)
+}
+
+// nextPage drops the extra row fetched by scope and returns the cursor of
+// the following page, nil on the last one.
+func nextPage[T any](p page, items []T, id func(T) uint) ([]T, *uint) {
+	if len(items) <= p.Limit {
+		return items, nil
+	}
+	items = items[:p.Limit]
+	last := id(items[len(items)-1])
+	return items, &last
+}
+
+func tweetID(tweet models.Tweet) uint {
+	return tweet.ID
+}
@@ -0,0 +1,388 @@
+package controllers
+
+import (
+	"encoding/base64"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"io"
+	"main/apierror"
+	"main/metrics"
+	"main/models"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Resumable uploads implement the core of the tus protocol
+// (https://tus.io/protocols/resumable-upload) with the creation, expiration
+// and termination extensions, plus a finalize step that turns a completed
+// upload into a Media row that CreateTweet can attach by ID.
+//
+// Partial uploads are kept in RESUMABLE_UPLOAD_DIR and their requests are
+// serialized in memory, so with several replicas the load balancer must
+// route /resumable/:id to the same one every time, or the directory must be
+// shared between them.
+
+const (
+	tusVersion         = "1.0.0"
+	tusExtensions      = "creation,expiration,termination"
+	resumableUploadTTL = 24 * time.Hour
+)
+
+// uploadLocks serializes the requests to each upload. A lock only exists
+// while requests hold or wait for it, so made up and expired IDs leave
+// nothing behind.
+type uploadLocks struct {
+	mu    sync.Mutex
+	locks map[string]*uploadLock
+}
+
+type uploadLock struct {
+	sync.Mutex
+	waiters int
+}
+
+// lock locks the upload id and returns the function unlocking it.
+func (l *uploadLocks) lock(id string) func() {
+	l.mu.Lock()
+	if l.locks == nil {
+		l.locks = make(map[string]*uploadLock)
+	}
+	lock := l.locks[id]
+	if lock == nil {
+		lock = &uploadLock{}
+		l.locks[id] = lock
+	}
+	lock.waiters++
+	l.mu.Unlock()
+
+	lock.Lock()
+	return func() {
+		lock.Unlock()
+		l.mu.Lock()
+		lock.waiters--
+		if lock.waiters == 0 {
+			delete(l.locks, id)
+		}
+		l.mu.Unlock()
+	}
+}
+
+func (h *Handler) resumablePath(id string) string {
+	return filepath.Join(h.Config.Storage.ResumableDir, id)
+}
+
+func setTusHeaders(c *gin.Context) {
+	c.Header("Tus-Resumable", tusVersion)
+	c.Header("Cache-Control", "no-store")
+}
+
+// checkTusVersion records a 412 error and returns false when the client
+// speaks another version of the protocol. Requests without a Tus-Resumable
+// header are let through, so plain HTTP clients can finalize uploads.
+func checkTusVersion(c *gin.Context) bool {
+	version := c.GetHeader("Tus-Resumable")
+	if version == "" || version == tusVersion {
+		return true
+	}
+	c.Header("Tus-Version", tusVersion)
+	c.Error(apierror.New(http.StatusPreconditionFailed, "unsupported_tus_version",
+		"Unsupported Tus-Resumable version, this server supports "+tusVersion))
+	return false
+}
+
+// findUploadSession loads an upload of the current user. It records an
+// error and returns false when the upload can't be used.
+func (h *Handler) findUploadSession(c *gin.Context, session *models.UploadSession) bool {
+	user, exists := c.Get("currentUser")
+	if !exists {
+		c.Error(apierror.Unauthorized("unauthenticated", "User not found"))
+		return false
+	}
+
+	userModel, ok := user.(models.User)
+	if !ok {
+		c.Error(apierror.Unauthorized("unauthenticated", "Invalid user"))
+		return false
+	}
+
+	err := h.DB.WithContext(c.Request.Context()).Where("id = ? AND owner_id = ?", c.Param("id"), userModel.ID).First(session).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.Error(apierror.NotFound("upload_not_found", "Upload not found"))
+		} else {
+			c.Error(apierror.Internal("Database query error", err))
+		}
+		return false
+	}
+
+	if time.Now().After(session.ExpiresAt) {
+		c.Error(apierror.New(http.StatusGone, "upload_expired", "Upload expired"))
+		return false
+	}
+
+	return true
+}
+
+// parseUploadMetadata decodes the Upload-Metadata header, a comma separated
+// list of "key base64(value)" pairs.
+func parseUploadMetadata(header string) map[string]string {
+	metadata := make(map[string]string)
+	for _, pair := range strings.Split(header, ",") {
+		parts := strings.Fields(pair)
+		if len(parts) == 0 {
+			continue
+		}
+		value := ""
+		if len(parts) > 1 {
+			decoded, err := base64.StdEncoding.DecodeString(parts[1])
+			if err != nil {
+				continue
+			}
+			value = string(decoded)
+		}
+		metadata[parts[0]] = value
+	}
+	return metadata
+}
+
+func (h *Handler) ResumableOptions(c *gin.Context) {
+	setTusHeaders(c)
+	c.Header("Tus-Version", tusVersion)
+	c.Header("Tus-Extension", tusExtensions)
+	c.Header("Tus-Max-Size", strconv.FormatInt(h.Config.Uploads.MaxResumableSize, 10))
+	c.Status(http.StatusNoContent)
+}
+
+func (h *Handler) CreateResumableUpload(c *gin.Context) {
+	setTusHeaders(c)
+	if !checkTusVersion(c) {
+		return
+	}
+
+	user, exists := c.Get("currentUser")
+	if !exists {
+		c.Error(apierror.Unauthorized("unauthenticated", "User not found"))
+		return
+	}
+
+	userModel, ok := user.(models.User)
+	if !ok {
+		c.Error(apierror.Unauthorized("unauthenticated", "Invalid user"))
+		return
+	}
+
+	length, err := strconv.ParseInt(c.GetHeader("Upload-Length"), 10, 64)
+	if err != nil || length <= 0 {
+		c.Error(apierror.BadRequest("invalid_upload_length", "Invalid Upload-Length"))
+		return
+	}
+	if length > h.Config.Uploads.MaxResumableSize {
+		c.Error(apierror.New(http.StatusRequestEntityTooLarge, "upload_too_large", "Upload is too large"))
+		return
+	}
+	if !h.checkUpload(c, userModel, length, false) {
+		return
+	}
+
+	metadata := parseUploadMetadata(c.GetHeader("Upload-Metadata"))
+
+	session := models.UploadSession{
+		ID:        uuid.NewString(),
+		OwnerID:   userModel.ID,
+		Length:    length,
+		FileName:  filepath.Base(metadata["filename"]),
+		FileType:  metadata["filetype"],
+		ExpiresAt: time.Now().Add(resumableUploadTTL),
+	}
+
+	file, err := os.OpenFile(h.resumablePath(session.ID), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0640)
+	if err != nil {
+		c.Error(apierror.Internal("Failed to create upload", err))
+		return
+	}
+	file.Close()
+
+	if err := h.DB.WithContext(c.Request.Context()).Create(&session).Error; err != nil {
+		os.Remove(h.resumablePath(session.ID))
+		c.Error(apierror.Internal("Failed to create upload", err))
+		return
+	}
+
+	c.Header("Location", "/resumable/"+session.ID)
+	c.Header("Upload-Expires", session.ExpiresAt.UTC().Format(http.TimeFormat))
+	c.Status(http.StatusCreated)
+}
+
+func (h *Handler) ResumableStatus(c *gin.Context) {
+	setTusHeaders(c)
+	if !checkTusVersion(c) {
+		return
+	}
+
+	var session models.UploadSession
+	if !h.findUploadSession(c, &session) {
+		return
+	}
+
+	c.Header("Upload-Offset", strconv.FormatInt(session.Offset, 10))
+	c.Header("Upload-Length", strconv.FormatInt(session.Length, 10))
+	c.Header("Upload-Expires", session.ExpiresAt.UTC().Format(http.TimeFormat))
+	c.Status(http.StatusOK)
+}
+
+func (h *Handler) AppendResumableChunk(c *gin.Context) {
+	setTusHeaders(c)
+	if !checkTusVersion(c) {
+		return
+	}
+
+	if c.ContentType() != "application/offset+octet-stream" {
+		c.Error(apierror.New(http.StatusUnsupportedMediaType, "unsupported_content_type", "Content-Type must be application/offset+octet-stream"))
+		return
+	}
+
+	offset, err := strconv.ParseInt(c.GetHeader("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		c.Error(apierror.BadRequest("invalid_upload_offset", "Invalid Upload-Offset"))
+		return
+	}
+
+	defer h.resumableLocks.lock(c.Param("id"))()
+
+	var session models.UploadSession
+	if !h.findUploadSession(c, &session) {
+		return
+	}
+
+	if offset != session.Offset {
+		c.Error(apierror.Conflict("offset_mismatch", "Upload-Offset does not match the current offset"))
+		return
+	}
+
+	file, err := os.OpenFile(h.resumablePath(session.ID), os.O_WRONLY, 0640)
+	if err != nil {
+		c.Error(apierror.Internal("Failed to open upload", err))
+		return
+	}
+	defer file.Close()
+
+	// Drop whatever a previous interrupted request wrote past the offset
+	// that was recorded.
+	if err := file.Truncate(session.Offset); err != nil {
+		c.Error(apierror.Internal("Failed to write chunk", err))
+		return
+	}
+	if _, err := file.Seek(session.Offset, io.SeekStart); err != nil {
+		c.Error(apierror.Internal("Failed to write chunk", err))
+		return
+	}
+
+	// Keep what was received even if the client disconnects mid-chunk, so
+	// the upload can resume from there.
+	written, copyErr := io.Copy(file, io.LimitReader(c.Request.Body, session.Length-session.Offset))
+	if err := file.Sync(); err != nil {
+		c.Error(apierror.Internal("Failed to write chunk", err))
+		return
+	}
+
+	metrics.UploadBytes.WithLabelValues("resumable").Add(float64(written))
+	session.Offset += written
+	session.ExpiresAt = time.Now().Add(resumableUploadTTL)
+	err = h.DB.WithContext(c.Request.Context()).Model(&session).Updates(map[string]interface{}{
+		"upload_offset": session.Offset,
+		"expires_at":    session.ExpiresAt,
+	}).Error
+	if err != nil {
+		c.Error(apierror.Internal("Failed to save upload offset", err))
+		return
+	}
+
+	if copyErr != nil {
+		c.Error(bodyError(copyErr, apierror.BadRequest("invalid_chunk", "Failed to read chunk")))
+		return
+	}
+
+	c.Header("Upload-Offset", strconv.FormatInt(session.Offset, 10))
+	c.Header("Upload-Expires", session.ExpiresAt.UTC().Format(http.TimeFormat))
+	c.Status(http.StatusNoContent)
+}
+
+func (h *Handler) DeleteResumableUpload(c *gin.Context) {
+	setTusHeaders(c)
+	if !checkTusVersion(c) {
+		return
+	}
+
+	defer h.resumableLocks.lock(c.Param("id"))()
+
+	var session models.UploadSession
+	if !h.findUploadSession(c, &session) {
+		return
+	}
+
+	if err := h.DB.WithContext(c.Request.Context()).Delete(&session).Error; err != nil {
+		c.Error(apierror.Internal("Failed to delete upload", err))
+		return
+	}
+	os.Remove(h.resumablePath(session.ID))
+
+	c.Status(http.StatusNoContent)
+}
+
+// FinalizeResumableUpload moves a completed upload to storage and returns the
+// Media it became, ready to be attached to a tweet through media_ids.
+func (h *Handler) FinalizeResumableUpload(c *gin.Context) {
+	setTusHeaders(c)
+	if !checkTusVersion(c) {
+		return
+	}
+
+	defer h.resumableLocks.lock(c.Param("id"))()
+
+	var session models.UploadSession
+	if !h.findUploadSession(c, &session) {
+		return
+	}
+
+	if session.Offset != session.Length {
+		c.Error(apierror.Conflict("upload_incomplete", "Upload is not complete"))
+		return
+	}
+
+	// The quota was checked when the upload was created, but other uploads
+	// may have finished since.
+	user, _ := c.Get("currentUser")
+	userModel := user.(models.User)
+	if !h.checkStorageQuota(c, userModel, session.Length, false) {
+		return
+	}
+
+	file, err := os.Open(h.resumablePath(session.ID))
+	if err != nil {
+		c.Error(apierror.Internal("Failed to open upload", err))
+		return
+	}
+	defer file.Close()
+
+	media, err := h.storeMedia(c.Request.Context(), session.OwnerID, file, session.Length, session.FileName, c.PostForm("alt_text"))
+	if err != nil {
+		abortWithMediaError(c, err)
+		return
+	}
+	h.countUpload(c.Request.Context(), userModel)
+
+	if err := h.DB.WithContext(c.Request.Context()).Delete(&session).Error; err != nil {
+		c.Error(apierror.Internal("Failed to delete upload", err))
+		return
+	}
+	os.Remove(h.resumablePath(session.ID))
+
+	c.JSON(http.StatusOK, gin.H{"media": h.mediaResponse(c.Request.Context(), media)})
+}
@@ -0,0 +1,150 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"image"
+	"image/png"
+	"io"
+	"main/middlewares"
+	"main/models"
+	"main/ratelimit"
+	"main/storage"
+	"main/testdb"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestUploadLocksAreDroppedWhenReleased(t *testing.T) {
+	var locks uploadLocks
+
+	var wg sync.WaitGroup
+	counter := 0
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			unlock := locks.lock("upload")
+			counter++
+			unlock()
+		}()
+	}
+	wg.Wait()
+	locks.lock("made-up-id")()
+
+	if counter != 50 {
+		t.Fatalf("got counter %d, want 50", counter)
+	}
+	if len(locks.locks) != 0 {
+		t.Fatalf("got %d locks left, want none", len(locks.locks))
+	}
+}
+
+func TestResumableUpload(t *testing.T) {
+	cfg := testdb.Config()
+	cfg.Storage.ResumableDir = t.TempDir()
+	db := testdb.Open(t)
+	signer := storage.NewURLSigner("secret", "http://localhost")
+	h := NewHandler(db, cfg, storage.NewLocalStorage(t.TempDir(), signer), signer, ratelimit.NewMemoryStore())
+
+	user := models.User{UserName: "uploader", Email: "uploader@example.com", Password: "x", Role: models.RoleUser}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(middlewares.Errors())
+	auth := func(c *gin.Context) { c.Set("currentUser", user) }
+	r.POST("/resumable", auth, h.CreateResumableUpload)
+	r.HEAD("/resumable/:id", auth, h.ResumableStatus)
+	r.PATCH("/resumable/:id", auth, h.AppendResumableChunk)
+	r.POST("/resumable/:id/finalize", auth, h.FinalizeResumableUpload)
+
+	serve := func(method, path string, headers map[string]string, body io.Reader) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, body)
+		req.Header.Set("Tus-Resumable", tusVersion)
+		for name, value := range headers {
+			req.Header.Set(name, value)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	patch := func(path string, offset int, chunk []byte) *httptest.ResponseRecorder {
+		return serve(http.MethodPatch, path, map[string]string{
+			"Content-Type":  "application/offset+octet-stream",
+			"Upload-Offset": strconv.Itoa(offset),
+		}, bytes.NewReader(chunk))
+	}
+
+	var picture bytes.Buffer
+	if err := png.Encode(&picture, image.NewRGBA(image.Rect(0, 0, 4, 4))); err != nil {
+		t.Fatal(err)
+	}
+	content := picture.Bytes()
+	half := len(content) / 2
+
+	w := serve(http.MethodPost, "/resumable", map[string]string{
+		"Tus-Resumable":   "0.2.2",
+		"Upload-Length":   strconv.Itoa(len(content)),
+		"Upload-Metadata": "filename " + base64.StdEncoding.EncodeToString([]byte("picture.png")),
+	}, nil)
+	if w.Code != http.StatusPreconditionFailed || w.Header().Get("Tus-Version") != tusVersion {
+		t.Fatalf("create with another tus version: got %d, Tus-Version %q, want 412 and %s",
+			w.Code, w.Header().Get("Tus-Version"), tusVersion)
+	}
+
+	w = serve(http.MethodPost, "/resumable", map[string]string{
+		"Upload-Length":   strconv.Itoa(len(content)),
+		"Upload-Metadata": "filename " + base64.StdEncoding.EncodeToString([]byte("picture.png")),
+	}, nil)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create: got %d: %s", w.Code, w.Body)
+	}
+	path := w.Header().Get("Location")
+
+	if w := patch(path, half, content[half:]); w.Code != http.StatusConflict {
+		t.Fatalf("PATCH at the wrong offset: got %d, want 409", w.Code)
+	}
+	if w := patch(path, 0, content[:half]); w.Code != http.StatusNoContent || w.Header().Get("Upload-Offset") != strconv.Itoa(half) {
+		t.Fatalf("PATCH first half: got %d, Upload-Offset %q", w.Code, w.Header().Get("Upload-Offset"))
+	}
+
+	w = serve(http.MethodHead, path, nil, nil)
+	if w.Code != http.StatusOK || w.Header().Get("Upload-Offset") != strconv.Itoa(half) ||
+		w.Header().Get("Upload-Length") != strconv.Itoa(len(content)) {
+		t.Fatalf("HEAD: got %d, Upload-Offset %q, Upload-Length %q", w.Code,
+			w.Header().Get("Upload-Offset"), w.Header().Get("Upload-Length"))
+	}
+
+	if w := serve(http.MethodPost, path+"/finalize", nil, nil); w.Code != http.StatusConflict {
+		t.Fatalf("finalize an incomplete upload: got %d, want 409", w.Code)
+	}
+	if w := patch(path, half, content[half:]); w.Code != http.StatusNoContent {
+		t.Fatalf("PATCH second half: got %d: %s", w.Code, w.Body)
+	}
+
+	w = serve(http.MethodPost, path+"/finalize", nil, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("finalize: got %d: %s", w.Code, w.Body)
+	}
+	var finalized struct {
+		Media struct {
+			ID   uint   `json:"id"`
+			Kind string `json:"kind"`
+		} `json:"media"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &finalized); err != nil || finalized.Media.ID == 0 || finalized.Media.Kind != "image" {
+		t.Fatalf("finalize: got %s, want an image", w.Body)
+	}
+
+	if w := serve(http.MethodHead, path, nil, nil); w.Code != http.StatusNotFound {
+		t.Fatalf("HEAD after finalizing: got %d, want 404", w.Code)
+	}
+}
@@ -0,0 +1,192 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"log/slog"
+	"main/apierror"
+	"main/config"
+	"main/models"
+	"main/ratelimit"
+	"main/utils"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// uploadPolicy is the hourly upload limit of quota, a bucket refilled over
+// the hour. It lives in the rate limit store, shared by every replica.
+func uploadPolicy(quota config.QuotaConfig) ratelimit.Policy {
+	return ratelimit.Policy{Name: "uploads_per_hour", Limit: quota.UploadsPerHour, Period: time.Hour}
+}
+
+// quotaFor returns the upload quota of the role of user. Unknown roles get
+// the user quota.
+func (h *Handler) quotaFor(user models.User) config.QuotaConfig {
+	if user.Role == models.RoleAdmin {
+		return h.Config.Uploads.AdminQuota
+	}
+	return h.Config.Uploads.UserQuota
+}
+
+func uploadLimitKey(user models.User) string {
+	return "user:" + strconv.FormatUint(uint64(user.ID), 10)
+}
+
+// storageUsage adds up what a user has stored: tweet images and attached
+// media, profile pictures, and media uploaded but not attached yet. Sizes
+// come from the blobs table, files stored before it existed count as 0 bytes.
+func (h *Handler) storageUsage(ctx context.Context, user models.User, quota config.QuotaConfig) (utils.StorageUsageResponse, error) {
+	usage := utils.StorageUsageResponse{
+		Role:           user.Role,
+		Quota:          utils.StorageUsage{Bytes: quota.MaxBytes, Files: quota.MaxFiles},
+		UploadsPerHour: quota.UploadsPerHour,
+	}
+
+	var tweetFiles utils.StorageUsage
+	err := h.DB.WithContext(ctx).Table("tweets").
+		Select("COUNT(*) AS files, COALESCE(SUM(blobs.size), 0) AS bytes").
+		Joins("LEFT JOIN blobs ON blobs.storage_key = tweets.file AND blobs.deleted_at IS NULL").
+		Where("tweets.author_id = ? AND tweets.file <> '' AND tweets.deleted_at IS NULL", user.ID).
+		Scan(&tweetFiles).Error
+	if err != nil {
+		return usage, err
+	}
+
+	var media []struct {
+		Attached bool
+		Files    int64
+		Bytes    int64
+	}
+	err = h.DB.WithContext(ctx).Model(&models.Media{}).
+		Select("tweet_id IS NOT NULL AS attached, COUNT(*) AS files, COALESCE(SUM(size), 0) AS bytes").
+		Where("owner_id = ?", user.ID).
+		Group("tweet_id IS NOT NULL").
+		Scan(&media).Error
+	if err != nil {
+		return usage, err
+	}
+
+	usage.Tweets = tweetFiles
+	for _, row := range media {
+		if row.Attached {
+			usage.Tweets.Files += row.Files
+			usage.Tweets.Bytes += row.Bytes
+		} else {
+			usage.PendingMedia = utils.StorageUsage{Files: row.Files, Bytes: row.Bytes}
+		}
+	}
+
+	if user.Picture != "" {
+		var picture models.Blob
+		err := h.DB.WithContext(ctx).Where("storage_key = ?", utils.StorageKey(user.Picture)).Limit(1).Find(&picture).Error
+		if err != nil {
+			return usage, err
+		}
+		usage.ProfilePictures = utils.StorageUsage{Files: 1, Bytes: picture.Size}
+	}
+
+	usage.Used.Files = usage.Tweets.Files + usage.ProfilePictures.Files + usage.PendingMedia.Files
+	usage.Used.Bytes = usage.Tweets.Bytes + usage.ProfilePictures.Bytes + usage.PendingMedia.Bytes
+
+	return usage, nil
+}
+
+// checkStorageQuota records a 413 error and returns false when storing size more
+// bytes would take the user over their quota. A file replacing another one
+// doesn't add to the file count.
+func (h *Handler) checkStorageQuota(c *gin.Context, user models.User, size int64, replacing bool) bool {
+	quota := h.quotaFor(user)
+	if quota.MaxBytes == 0 && quota.MaxFiles == 0 {
+		return true
+	}
+
+	usage, err := h.storageUsage(c.Request.Context(), user, quota)
+	if err != nil {
+		c.Error(apierror.Internal("Failed to compute storage usage", err))
+		return false
+	}
+
+	files := usage.Used.Files
+	if !replacing {
+		files++
+	}
+	if quota.MaxFiles > 0 && files > quota.MaxFiles {
+		c.Error(apierror.New(http.StatusRequestEntityTooLarge, "storage_quota_exceeded",
+			fmt.Sprintf("Storage quota exceeded: you already have %d of %d files. Delete some tweets with media or unused uploads to free up space.",
+				usage.Used.Files, quota.MaxFiles),
+		).WithDetails(gin.H{"storage": usage}))
+		return false
+	}
+
+	if quota.MaxBytes > 0 && usage.Used.Bytes+size > quota.MaxBytes {
+		c.Error(apierror.New(http.StatusRequestEntityTooLarge, "storage_quota_exceeded",
+			fmt.Sprintf("Storage quota exceeded: you are using %s of %s and this upload needs %s. Delete some tweets with media or unused uploads to free up space.",
+				utils.FormatBytes(usage.Used.Bytes), utils.FormatBytes(quota.MaxBytes), utils.FormatBytes(size)),
+		).WithDetails(gin.H{"storage": usage}))
+		return false
+	}
+
+	return true
+}
+
+// checkUpload applies the storage quota and the hourly upload limit to an
+// upload of size bytes, replacing a file the user already has if replacing
+// is true. It records an error and returns false when the upload must be
+// rejected. The upload only counts against the hourly limit once it is
+// stored, see countUpload.
+func (h *Handler) checkUpload(c *gin.Context, user models.User, size int64, replacing bool) bool {
+	if !h.checkStorageQuota(c, user, size, replacing) {
+		return false
+	}
+
+	quota := h.quotaFor(user)
+	if quota.UploadsPerHour > 0 {
+		res, err := h.RateLimits.Peek(c.Request.Context(), uploadLimitKey(user), uploadPolicy(quota))
+		if err != nil {
+			slog.ErrorContext(c.Request.Context(), "Rate limit store failed, letting the upload through", "error", err)
+		} else if !res.Allowed {
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(res.RetryAfter.Seconds()))))
+			c.Error(apierror.New(http.StatusTooManyRequests, "upload_limit_reached",
+				fmt.Sprintf("Upload limit reached: at most %d uploads per hour. Try again later.", quota.UploadsPerHour)))
+			return false
+		}
+	}
+
+	return true
+}
+
+// countUpload counts a stored upload of user against their hourly limit.
+func (h *Handler) countUpload(ctx context.Context, user models.User) {
+	quota := h.quotaFor(user)
+	if quota.UploadsPerHour <= 0 {
+		return
+	}
+	if _, err := h.RateLimits.Take(ctx, uploadLimitKey(user), uploadPolicy(quota)); err != nil {
+		slog.ErrorContext(ctx, "Failed to count upload", "error", err)
+	}
+}
+
+func (h *Handler) UserStorage(c *gin.Context) {
+	user, exists := c.Get("currentUser")
+	if !exists {
+		c.Error(apierror.Unauthorized("unauthenticated", "User not found"))
+		return
+	}
+
+	userModel, ok := user.(models.User)
+	if !ok {
+		c.Error(apierror.Unauthorized("unauthenticated", "Invalid user"))
+		return
+	}
+
+	usage, err := h.storageUsage(c.Request.Context(), userModel, h.quotaFor(userModel))
+	if err != nil {
+		c.Error(apierror.Internal("Failed to compute storage usage", err))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"storage": usage})
+}
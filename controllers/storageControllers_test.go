@@ -0,0 +1,135 @@
+package controllers
+
+import (
+	"bytes"
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"image"
+	"image/png"
+	"main/metrics"
+	"main/middlewares"
+	"main/models"
+	"main/ratelimit"
+	"main/storage"
+	"main/testdb"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRejectedUploadsDontCountAgainstHourlyLimit(t *testing.T) {
+	cfg := testdb.Config()
+	cfg.Uploads.UserQuota.UploadsPerHour = 1
+	db := testdb.Open(t)
+	signer := storage.NewURLSigner("secret", "http://localhost")
+	h := NewHandler(db, cfg, storage.NewLocalStorage(t.TempDir(), signer), signer, ratelimit.NewMemoryStore())
+
+	user := models.User{UserName: "uploader", Email: "uploader@example.com", Password: "x", Role: models.RoleUser}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(middlewares.Errors())
+	r.POST("/media", func(c *gin.Context) { c.Set("currentUser", user) }, h.UploadMedia)
+
+	upload := func(name string, content []byte) int {
+		var body bytes.Buffer
+		form := multipart.NewWriter(&body)
+		part, _ := form.CreateFormFile("file", name)
+		part.Write(content)
+		form.Close()
+
+		req := httptest.NewRequest(http.MethodPost, "/media", &body)
+		req.Header.Set("Content-Type", form.FormDataContentType())
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	var picture bytes.Buffer
+	if err := png.Encode(&picture, image.NewRGBA(image.Rect(0, 0, 4, 4))); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if code := upload("notes.txt", []byte("not a picture")); code != http.StatusUnsupportedMediaType {
+			t.Fatalf("invalid upload %d: got %d, want 415", i, code)
+		}
+	}
+	if code := upload("picture.png", picture.Bytes()); code != http.StatusOK {
+		t.Fatalf("valid upload: got %d, want 200", code)
+	}
+	if code := upload("picture.png", picture.Bytes()); code != http.StatusTooManyRequests {
+		t.Fatalf("upload over the limit: got %d, want 429", code)
+	}
+}
+
+func TestReplacingPictureAtFileLimit(t *testing.T) {
+	cfg := testdb.Config()
+	cfg.Uploads.UserQuota.MaxFiles = 1
+	db := testdb.Open(t)
+	signer := storage.NewURLSigner("secret", "http://localhost")
+	h := NewHandler(db, cfg, storage.NewLocalStorage(t.TempDir(), signer), signer, ratelimit.NewMemoryStore())
+
+	user := models.User{UserName: "uploader", Email: "uploader@example.com", Password: "x", Role: models.RoleUser}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(middlewares.Errors())
+	// Like the auth middleware, load the user afresh on every request.
+	auth := func(c *gin.Context) {
+		var current models.User
+		if err := db.First(&current, user.ID).Error; err != nil {
+			t.Fatal(err)
+		}
+		c.Set("currentUser", current)
+	}
+	r.PUT("/user", auth, h.UserUpdate)
+	r.POST("/media", auth, h.UploadMedia)
+
+	// upload sends a square picture of side pixels and returns the status
+	// and the size of the picture.
+	upload := func(method, path, field string, side int) (int, int) {
+		var picture bytes.Buffer
+		if err := png.Encode(&picture, image.NewRGBA(image.Rect(0, 0, side, side))); err != nil {
+			t.Fatal(err)
+		}
+		var body bytes.Buffer
+		form := multipart.NewWriter(&body)
+		part, _ := form.CreateFormFile(field, "picture.png")
+		part.Write(picture.Bytes())
+		form.Close()
+
+		req := httptest.NewRequest(method, path, &body)
+		req.Header.Set("Content-Type", form.FormDataContentType())
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code, picture.Len()
+	}
+
+	uploadBytes := metrics.UploadBytes.WithLabelValues("form")
+	before := testutil.ToFloat64(uploadBytes)
+
+	code, first := upload(http.MethodPut, "/user", "Picture", 4)
+	if code != http.StatusOK {
+		t.Fatalf("first picture: got %d, want 200", code)
+	}
+	code, second := upload(http.MethodPut, "/user", "Picture", 8)
+	if code != http.StatusOK {
+		t.Fatalf("replacing the picture at the file limit: got %d, want 200", code)
+	}
+	if code, _ := upload(http.MethodPost, "/media", "file", 4); code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("another file at the file limit: got %d, want 413", code)
+	}
+
+	// The rejected upload isn't counted.
+	if got := testutil.ToFloat64(uploadBytes) - before; got != float64(first+second) {
+		t.Fatalf("counted %v uploaded bytes, want %d", got, first+second)
+	}
+}
@@ -2,39 +2,58 @@ package controllers
 
 import "C"
 import (
+	"context"
 	"errors"
-	"fmt"
 	"github.com/gin-gonic/gin"
-	"gorm.io/gorm"
-	"main/initializers"
+	"log/slog"
+	"main/apierror"
+	"main/metrics"
 	"main/models"
+	"main/repositories"
 	"main/utils"
 	"net/http"
-	"path/filepath"
+	"strconv"
 	"time"
 )
 
-func CreateTweet(c *gin.Context) {
-	if err := c.Request.ParseMultipartForm(30 << 20); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to parse form"})
+func (h *Handler) CreateTweet(c *gin.Context) {
+	if err := c.Request.ParseMultipartForm(h.Config.Uploads.MaxFormMemory); err != nil {
+		c.Error(bodyError(err, apierror.BadRequest("invalid_form", "Failed to parse form")))
 		return
 	}
 
 	user, exists := c.Get("currentUser")
 	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		c.Error(apierror.Unauthorized("unauthenticated", "User not found"))
 		return
 	}
 
 	userModel, ok := user.(models.User)
 	if !ok {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user"})
+		c.Error(apierror.Unauthorized("unauthenticated", "Invalid user"))
 		return
 	}
 
 	Title := c.Request.FormValue("title")
 	Body := c.Request.FormValue("body")
 
+	mediaIDs, err := parseMediaIDs(c)
+	if err != nil {
+		c.Error(apierror.BadRequest("invalid_media", err.Error()))
+		return
+	}
+
+	media, err := h.findAttachableMedia(c.Request.Context(), userModel.ID, mediaIDs)
+	if err != nil {
+		var mediaErr *mediaError
+		if errors.As(err, &mediaErr) {
+			c.Error(apierror.BadRequest("invalid_media", mediaErr.Error()))
+		} else {
+			c.Error(apierror.Internal("Database query error", err))
+		}
+		return
+	}
+
 	var filePath string
 	file, err := c.FormFile("file")
 	if errors.Is(err, http.ErrMissingFile) {
@@ -42,11 +61,36 @@ func CreateTweet(c *gin.Context) {
 	}
 
 	if file != nil {
-		filePath = utils.GetUniqueFileName("uploads/tweets/", time.Now().Format("20060102150405"), filepath.Ext(file.Filename))
-		errFile := c.SaveUploadedFile(file, filePath)
-		if errFile != nil {
+		if !h.checkUpload(c, userModel, file.Size, false) {
 			return
 		}
+
+		isVideo, err := isVideoFile(file)
+		if err != nil {
+			c.Error(apierror.BadRequest("invalid_file", "Failed to read file"))
+			return
+		}
+
+		if isVideo {
+			// Videos are kept as media so their metadata has somewhere to live.
+			if len(media) > 0 {
+				c.Error(apierror.BadRequest("invalid_media", "A tweet can have only one video and no images alongside it"))
+				return
+			}
+			video, err := h.saveMedia(c.Request.Context(), userModel.ID, file, c.Request.FormValue("alt_text"))
+			if err != nil {
+				abortWithMediaError(c, err)
+				return
+			}
+			media = []models.Media{video}
+		} else {
+			filePath, _, err = h.saveImage(c.Request.Context(), file, utils.TweetMediaVariants)
+			if err != nil {
+				abortWithImageError(c, err)
+				return
+			}
+		}
+		h.countUpload(c.Request.Context(), userModel)
 	} else {
 		filePath = ""
 	}
@@ -58,109 +102,114 @@ func CreateTweet(c *gin.Context) {
 		AuthorID: userModel.ID,
 	}
 
-	initializers.DB.Create(&tweet)
+	err = h.Repos.Tweets.Create(c.Request.Context(), &tweet, media)
+	if err != nil {
+		h.releaseFile(c.Request.Context(), filePath)
+		var attachedErr *repositories.MediaAttachedError
+		if errors.As(err, &attachedErr) {
+			c.Error(apierror.Conflict("media_attached", attachedErr.Error()).
+				WithDetails(gin.H{"media_id": attachedErr.MediaID}))
+		} else {
+			c.Error(apierror.Internal("Failed to create tweet", err))
+		}
+		return
+	}
+	metrics.TweetsCreated.Inc()
 
-	response := utils.TweetResponse{
-		ID:        tweet.ID,
-		CreatedAt: tweet.CreatedAt.Format(time.RFC3339),
-		UpdatedAt: tweet.UpdatedAt.Format(time.RFC3339),
-		Title:     tweet.Title,
-		Body:      tweet.Body,
-		File:      tweet.File,
+	h.indexTweet(c.Request.Context(), tweet)
+
+	response, err := h.tweetResponses(c.Request.Context(), []models.Tweet{tweet})
+	if err != nil {
+		c.Error(apierror.Internal("Failed to load tweet", err))
+		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"tweet": response})
+	c.JSON(http.StatusOK, gin.H{"tweet": response[0]})
 }
 
-func TweetList(c *gin.Context) {
+func (h *Handler) TweetList(c *gin.Context) {
 	searchQuery := c.Query("search")
 
-	var tweets []map[string]interface{}
-
-	query := initializers.DB.Model(&models.Tweet{}).Select("id, title, body, created_at")
-
-	if searchQuery != "" {
-		query = query.Where("title ILIKE ? OR body ILIKE ?", "%"+searchQuery+"%", "%"+searchQuery+"%")
-	}
-
-	err := query.Find(&tweets).Error
+	found, err := h.Repos.Tweets.Search(c.Request.Context(), searchQuery)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database query error"})
+		c.Error(apierror.Internal("Database query error", err))
 		return
 	}
 
+	tweets := make([]gin.H, 0, len(found))
+	for _, tweet := range found {
+		tweets = append(tweets, gin.H{
+			"id":          tweet.ID,
+			"title":       tweet.Title,
+			"body":        tweet.Body,
+			"created_at":  tweet.CreatedAt,
+			"likes_count": tweet.LikesCount,
+		})
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"tweets": tweets,
 	})
 }
 
-func TweetRetrieve(c *gin.Context) {
-	id := c.Param("id")
-
-	var tweet models.Tweet
+func (h *Handler) TweetRetrieve(c *gin.Context) {
+	id, ok := parseTweetID(c)
+	if !ok {
+		return
+	}
 
-	err := initializers.DB.Where("id = ?", id).First(&tweet).Error
+	tweet, err := h.Repos.Tweets.FindByID(c.Request.Context(), id)
 
 	if err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Tweet not found"})
+		if errors.Is(err, repositories.ErrNotFound) {
+			c.Error(apierror.NotFound("tweet_not_found", "Tweet not found"))
 		} else {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database query error"})
+			c.Error(apierror.Internal("Database query error", err))
 		}
 		return
 	}
 
-	var likeCount int64
-	err = initializers.DB.Model(&models.LikeModel{}).Where("tweet_id = ?", tweet.ID).Count(&likeCount).Error
+	response, err := h.tweetResponses(c.Request.Context(), []models.Tweet{tweet})
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error counting likes"})
+		c.Error(apierror.Internal("Failed to load tweet", err))
 		return
 	}
 
-	response := utils.TweetResponse{
-		ID:        tweet.ID,
-		CreatedAt: tweet.CreatedAt.Format(time.RFC3339),
-		UpdatedAt: tweet.UpdatedAt.Format(time.RFC3339),
-		Title:     tweet.Title,
-		Body:      tweet.Body,
-		File:      tweet.File,
-		LikeCount: likeCount,
-	}
-
 	c.JSON(http.StatusOK, gin.H{
-		"tweet": response,
+		"tweet": response[0],
 	})
 }
 
-func TweetUpdate(c *gin.Context) {
-	id := c.Param("id")
+func (h *Handler) TweetUpdate(c *gin.Context) {
+	id, ok := parseTweetID(c)
+	if !ok {
+		return
+	}
 
-	if err := c.Request.ParseMultipartForm(30 << 20); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to parse form"})
+	if err := c.Request.ParseMultipartForm(h.Config.Uploads.MaxFormMemory); err != nil {
+		c.Error(bodyError(err, apierror.BadRequest("invalid_form", "Failed to parse form")))
 		return
 	}
 
 	user, exists := c.Get("currentUser")
 	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		c.Error(apierror.Unauthorized("unauthenticated", "User not found"))
 		return
 	}
 
 	userModel, ok := user.(models.User)
 	if !ok {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user"})
+		c.Error(apierror.Unauthorized("unauthenticated", "Invalid user"))
 		return
 	}
 
-	var tweet models.Tweet
-
-	err := initializers.DB.Where("id = ? AND author_id = ?", id, userModel.ID).First(&tweet).Error
+	tweet, err := h.Repos.Tweets.FindByAuthor(c.Request.Context(), id, userModel.ID)
 
 	if err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Tweet not found"})
+		if errors.Is(err, repositories.ErrNotFound) {
+			c.Error(apierror.NotFound("tweet_not_found", "Tweet not found"))
 		} else {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database query error"})
+			c.Error(apierror.Internal("Database query error", err))
 		}
 		return
 	}
@@ -169,76 +218,153 @@ func TweetUpdate(c *gin.Context) {
 	body := c.Request.FormValue("body")
 
 	var filePath string
+	uploaded := false
 	file, err := c.FormFile("file")
 	if err == nil {
-		fileName := time.Now().Format("20060102150405") + filepath.Ext(file.Filename)
-		filePath = filepath.Join("uploads/tweets", fileName)
-		if err := c.SaveUploadedFile(file, filePath); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save file"})
+		if !h.checkUpload(c, userModel, file.Size, tweet.File != "") {
 			return
 		}
+		filePath, _, err = h.saveImage(c.Request.Context(), file, utils.TweetMediaVariants)
+		if err != nil {
+			abortWithImageError(c, err)
+			return
+		}
+		uploaded = true
+		h.countUpload(c.Request.Context(), userModel)
 	} else {
 		filePath = tweet.File
 	}
 
-	fmt.Println(filePath)
-
 	if title != "" {
 		tweet.Title = title
 	}
 	if body != "" {
 		tweet.Body = body
 	}
+	oldFile := tweet.File
 	if filePath != "" {
 		tweet.File = filePath
 	}
 
-	if err := initializers.DB.Save(&tweet).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update user"})
+	if err := h.Repos.Tweets.Save(c.Request.Context(), &tweet); err != nil {
+		if uploaded {
+			h.releaseFile(c.Request.Context(), filePath)
+		}
+		c.Error(apierror.Internal("Failed to update tweet", err))
 		return
 	}
 
+	// Uploading the same image again took another reference to the same
+	// file, so the old one is released even when they are equal.
+	if uploaded {
+		h.releaseFile(c.Request.Context(), oldFile)
+	}
+
+	h.indexTweet(c.Request.Context(), tweet)
+
 	c.JSON(http.StatusOK, gin.H{
 		"user": gin.H{
-			"title": tweet.Title,
-			"body":  tweet.Body,
-			"file":  tweet.File,
+			"title":       tweet.Title,
+			"body":        tweet.Body,
+			"file":        h.fileURL(c.Request.Context(), tweet.File),
+			"likes_count": tweet.LikesCount,
 		},
 	})
 }
 
-func TweetDelete(c *gin.Context) {
-	id := c.Param("id")
+func (h *Handler) TweetDelete(c *gin.Context) {
+	id, ok := parseTweetID(c)
+	if !ok {
+		return
+	}
 
 	user, exists := c.Get("currentUser")
 	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		c.Error(apierror.Unauthorized("unauthenticated", "User not found"))
 		return
 	}
 
 	userModel, ok := user.(models.User)
 	if !ok {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user"})
+		c.Error(apierror.Unauthorized("unauthenticated", "Invalid user"))
 		return
 	}
 
-	var tweet models.Tweet
-
-	err := initializers.DB.Where("id = ? AND author_id = ?", id, userModel.ID).First(&tweet).Error
+	tweet, err := h.Repos.Tweets.FindByAuthor(c.Request.Context(), id, userModel.ID)
 
 	if err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Tweet not found"})
+		if errors.Is(err, repositories.ErrNotFound) {
+			c.Error(apierror.NotFound("tweet_not_found", "Tweet not found"))
 		} else {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database query error"})
+			c.Error(apierror.Internal("Database query error", err))
 		}
 		return
 	}
 
-	if err := initializers.DB.Delete(&tweet).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete tweet"})
+	files, err := h.Repos.Tweets.Delete(c.Request.Context(), &tweet)
+	if err != nil {
+		c.Error(apierror.Internal("Failed to delete tweet", err))
 		return
 	}
+	for _, file := range files {
+		h.releaseFile(c.Request.Context(), file)
+	}
 
-	c.JSON(http.StatusNoContent, gin.H{"message": "Tweet deleted successfully"})
+	c.Status(http.StatusNoContent)
+}
+
+// parseTweetID reads the tweet ID from the URL. It records a 404 error and
+// returns false when it isn't a number, as no tweet can have such an ID.
+func parseTweetID(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 0)
+	if err != nil {
+		c.Error(apierror.NotFound("tweet_not_found", "Tweet not found"))
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// indexTweet syncs the hashtags and mentions of a tweet that was just saved.
+// A failure is only logged: the tweet is there, failing the request would
+// make the client post it again, and reindex-search rebuilds what's missing.
+func (h *Handler) indexTweet(ctx context.Context, tweet models.Tweet) {
+	if err := h.Search.Index(ctx, tweet); err != nil {
+		slog.ErrorContext(ctx, "Failed to index tweet", "tweet_id", tweet.ID, "error", err)
+	}
+}
+
+// tweetResponses turns tweets into their API representation, loading the
+// mentions and media of all of them at once.
+func (h *Handler) tweetResponses(ctx context.Context, tweets []models.Tweet) ([]utils.TweetResponse, error) {
+	tweetIDs := make([]uint, 0, len(tweets))
+	for _, tweet := range tweets {
+		tweetIDs = append(tweetIDs, tweet.ID)
+	}
+
+	mentions, err := h.loadMentionEntities(ctx, tweetIDs)
+	if err != nil {
+		return nil, err
+	}
+	media, err := h.loadMediaResponses(ctx, tweetIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	responses := make([]utils.TweetResponse, 0, len(tweets))
+	for _, tweet := range tweets {
+		responses = append(responses, utils.TweetResponse{
+			ID:           tweet.ID,
+			CreatedAt:    tweet.CreatedAt.Format(time.RFC3339),
+			UpdatedAt:    tweet.UpdatedAt.Format(time.RFC3339),
+			Title:        tweet.Title,
+			Body:         tweet.Body,
+			File:         h.fileURL(ctx, tweet.File),
+			FileVariants: h.variantURLs(ctx, tweet.File, utils.TweetMediaVariants),
+			LikesCount:   tweet.LikesCount,
+			Mentions:     mentions[tweet.ID],
+			Media:        media[tweet.ID],
+			Video:        videoResponse(media[tweet.ID]),
+		})
+	}
+	return responses, nil
 }
@@ -0,0 +1,217 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"io"
+	"log/slog"
+	"main/apierror"
+	"main/metrics"
+	"main/storage"
+	"main/utils"
+	"mime/multipart"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+)
+
+// mediaURLExpiry is how long URLs handed out in responses stay valid at
+// least, see URLSigner.Sign.
+const mediaURLExpiry = 24 * time.Hour
+
+// saveImage validates and stores an uploaded image, see storeImage.
+func (h *Handler) saveImage(ctx context.Context, file *multipart.FileHeader, variants []utils.ImageVariant) (string, *utils.ProcessedImage, error) {
+	src, err := file.Open()
+	if err != nil {
+		return "", nil, err
+	}
+	defer src.Close()
+
+	filePath, img, err := h.storeImage(ctx, src, variants)
+	if err != nil {
+		return "", nil, err
+	}
+	metrics.UploadBytes.WithLabelValues("form").Add(float64(file.Size))
+	return filePath, img, nil
+}
+
+// storeImage validates and re-encodes an image, stores it by content hash and
+// makes sure a resized copy exists for each variant.
+func (h *Handler) storeImage(ctx context.Context, r io.Reader, variants []utils.ImageVariant) (string, *utils.ProcessedImage, error) {
+	img, err := utils.ProcessImage(r)
+	if err != nil {
+		return "", nil, err
+	}
+
+	key, err := h.Blobs.Store(ctx, bytes.NewReader(img.Data), img.Ext, img.MimeType)
+	if err != nil {
+		return "", nil, err
+	}
+
+	for _, variant := range variants {
+		variantKey := utils.VariantPath(key, variant.Name)
+		if _, err := h.Storage.Stat(ctx, variantKey); err == nil {
+			continue
+		}
+
+		data, err := utils.EncodeImage(utils.ResizeImage(img.Image, variant), img.MimeType)
+		if err != nil {
+			return "", nil, err
+		}
+		if err := h.Storage.Put(ctx, variantKey, bytes.NewReader(data), int64(len(data)), img.MimeType); err != nil {
+			return "", nil, err
+		}
+	}
+
+	return key, img, nil
+}
+
+// isVideoFile sniffs whether an uploaded file is a video.
+func isVideoFile(file *multipart.FileHeader) (bool, error) {
+	src, err := file.Open()
+	if err != nil {
+		return false, err
+	}
+	defer src.Close()
+
+	header := make([]byte, 512)
+	n, err := io.ReadFull(src, header)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return false, err
+	}
+
+	return utils.IsVideoHeader(header[:n]), nil
+}
+
+// abortWithImageError records the error of a failed saveImage call.
+func abortWithImageError(c *gin.Context, err error) {
+	status := utils.ImageErrorStatus(err)
+	if status >= 500 {
+		c.Error(apierror.Internal("Failed to save file", err))
+		return
+	}
+	c.Error(apierror.New(status, fileErrorCode(status), err.Error()))
+}
+
+// bodyError returns the error to record when the body of a request couldn't
+// be read: a 413 if it went over the size limit, fallback otherwise.
+func bodyError(err error, fallback *apierror.Error) *apierror.Error {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return apierror.New(http.StatusRequestEntityTooLarge, "request_too_large",
+			fmt.Sprintf("Request body must be at most %s", utils.FormatBytes(tooLarge.Limit)))
+	}
+	return fallback.Wrap(err)
+}
+
+// fileErrorCode returns the code of a rejected upload from its status.
+func fileErrorCode(status int) string {
+	switch status {
+	case http.StatusUnsupportedMediaType:
+		return "unsupported_media_type"
+	case http.StatusRequestEntityTooLarge:
+		return "file_too_large"
+	default:
+		return "invalid_file"
+	}
+}
+
+// fileURL returns the URL clients should load a stored file from.
+func (h *Handler) fileURL(ctx context.Context, value string) string {
+	if value == "" {
+		return ""
+	}
+	url, err := h.Storage.SignedURL(ctx, utils.StorageKey(value), mediaURLExpiry)
+	if err != nil {
+		slog.WarnContext(ctx, "Failed to sign file URL", "file", value, "error", err)
+		return ""
+	}
+	return url
+}
+
+// releaseFile drops a reference to a stored file. A failure is only logged,
+// the file GC collects whatever is left behind.
+func (h *Handler) releaseFile(ctx context.Context, value string) {
+	if err := h.Blobs.Release(ctx, value); err != nil {
+		slog.WarnContext(ctx, "Failed to release file", "file", value, "error", err)
+	}
+}
+
+// variantURLs returns the URL of every variant of a stored image, keyed by
+// variant name.
+func (h *Handler) variantURLs(ctx context.Context, value string, variants []utils.ImageVariant) map[string]string {
+	if value == "" {
+		return nil
+	}
+
+	urls := make(map[string]string, len(variants))
+	for _, variant := range variants {
+		urls[variant.Name] = h.fileURL(ctx, utils.VariantPath(utils.StorageKey(value), variant.Name))
+	}
+	return urls
+}
+
+// ServeUpload serves a stored upload through a URL signed by fileURL. The
+// size query parameter selects one of the resized variants, falling back to
+// the original when the variant was never generated (e.g. for files uploaded
+// before variants existed). Range requests and conditional requests are
+// handled by http.ServeContent.
+func (h *Handler) ServeUpload(c *gin.Context) {
+	ctx := c.Request.Context()
+	key := strings.TrimPrefix(c.Param("filepath"), "/")
+
+	expiresAt, err := h.Signer.Verify(key, c.Query("expires"), c.Query("signature"))
+	if err != nil {
+		switch {
+		case errors.Is(err, storage.ErrInvalidKey):
+			c.Error(apierror.NotFound("file_not_found", "File not found"))
+		case errors.Is(err, storage.ErrURLExpired):
+			c.Error(apierror.Forbidden("url_expired", "URL expired"))
+		default:
+			c.Error(apierror.Forbidden("invalid_signature", "Invalid signature"))
+		}
+		return
+	}
+
+	if size := c.Query("size"); size != "" {
+		if _, ok := utils.FindImageVariant(size); !ok {
+			c.Error(apierror.BadRequest("invalid_size", "Invalid size"))
+			return
+		}
+		variantKey := utils.VariantPath(key, size)
+		if _, err := h.Storage.Stat(ctx, variantKey); err == nil {
+			key = variantKey
+		}
+	}
+
+	reader, info, err := h.Storage.Get(ctx, key)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) || errors.Is(err, storage.ErrInvalidKey) {
+			c.Error(apierror.NotFound("file_not_found", "File not found"))
+		} else {
+			c.Error(apierror.Internal("Failed to read file", err))
+		}
+		return
+	}
+	defer reader.Close()
+
+	if info.ContentType != "" {
+		c.Header("Content-Type", info.ContentType)
+	}
+	// Stored files never change under the same key, so they can be cached
+	// for as long as the URL is valid.
+	c.Header("Cache-Control", fmt.Sprintf("private, max-age=%d, immutable", int(time.Until(expiresAt).Seconds())))
+	c.Header("ETag", fileETag(info))
+	http.ServeContent(c.Writer, c.Request, path.Base(key), info.ModTime, reader)
+}
+
+func fileETag(info *storage.ObjectInfo) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s\n%d\n%d", info.Key, info.Size, info.ModTime.UnixNano())))
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
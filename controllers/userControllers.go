@@ -1,23 +1,28 @@
 package controllers
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
+	"go.opentelemetry.io/otel/attribute"
 	"golang.org/x/crypto/bcrypt"
-	"main/initializers"
+	"main/apierror"
+	"main/metrics"
 	"main/models"
+	"main/repositories"
+	"main/tracing"
 	"main/utils"
 	"net/http"
-	"os"
-	"path/filepath"
 	"time"
 )
 
-func SignUp(c *gin.Context) {
-	if err := c.Request.ParseMultipartForm(10 << 20); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to parse form"})
+func (h *Handler) SignUp(c *gin.Context) {
+	cfg := h.Config
+
+	if err := c.Request.ParseMultipartForm(cfg.Uploads.MaxFormMemory); err != nil {
+		c.Error(bodyError(err, apierror.BadRequest("invalid_form", "Failed to parse form")))
 		return
 	}
 
@@ -26,32 +31,34 @@ func SignUp(c *gin.Context) {
 	Email := c.Request.FormValue("Email")
 	Bio := c.Request.FormValue("Bio")
 
-	var userFound models.User
-	initializers.DB.Where("username=?", UserName).Find(&userFound)
-
-	if userFound.ID != 0 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Username already used"})
+	_, err := h.Repos.Users.FindByUserName(c.Request.Context(), UserName)
+	if err == nil {
+		c.Error(apierror.BadRequest("username_taken", "Username already used"))
+		return
+	}
+	if !errors.Is(err, repositories.ErrNotFound) {
+		c.Error(apierror.Internal("Database query error", err))
 		return
 	}
 
 	if !utils.IsValidEmail(Email) {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid email format"})
+		c.Error(apierror.BadRequest("invalid_email", "Invalid email format"))
 		return
 	}
 
 	if len(Password) < 8 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Password must be at least 8 characters long"})
+		c.Error(apierror.BadRequest("weak_password", "Password must be at least 8 characters long"))
 		return
 	}
 
 	if !utils.IsStrongPassword(Password) {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Password must contain at least one uppercase letter, one lowercase letter, one number, and one special character"})
+		c.Error(apierror.BadRequest("weak_password", "Password must contain at least one uppercase letter, one lowercase letter, one number, and one special character"))
 		return
 	}
 
-	passwordHash, errPassword := bcrypt.GenerateFromPassword([]byte(Password), bcrypt.DefaultCost)
+	passwordHash, errPassword := hashPassword(c.Request.Context(), Password)
 	if errPassword != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": errPassword.Error()})
+		c.Error(apierror.BadRequest("invalid_password", errPassword.Error()).Wrap(errPassword))
 		return
 	}
 
@@ -62,9 +69,9 @@ func SignUp(c *gin.Context) {
 	}
 
 	if file != nil {
-		filePath = utils.GetUniqueFileName("uploads/profile_pictures/", time.Now().Format("20060102150405"), filepath.Ext(file.Filename))
-		errFile := c.SaveUploadedFile(file, filePath)
-		if errFile != nil {
+		filePath, _, err = h.saveImage(c.Request.Context(), file, utils.AvatarVariants)
+		if err != nil {
+			abortWithImageError(c, err)
 			return
 		}
 	} else {
@@ -79,24 +86,32 @@ func SignUp(c *gin.Context) {
 		Picture:  filePath,
 	}
 
-	initializers.DB.Create(&user)
+	if err := h.Repos.Users.Create(c.Request.Context(), &user); err != nil {
+		h.releaseFile(c.Request.Context(), filePath)
+		c.Error(apierror.Internal("Failed to create user", err))
+		return
+	}
+	metrics.Signups.Inc()
 
 	response := utils.UserResponse{
-		UserName: user.UserName,
-		Email:    user.Email,
+		UserName:        user.UserName,
+		Email:           user.Email,
+		FollowersCount:  user.FollowersCount,
+		FollowingsCount: user.FollowingsCount,
+		TweetsCount:     user.TweetsCount,
 	}
 
 	c.JSON(http.StatusOK,
 		gin.H{"data": response})
 }
 
-func Login(c *gin.Context) {
-	var loginInput utils.LoginInput
+func (h *Handler) Login(c *gin.Context) {
+	cfg := h.Config
 
-	fmt.Println(loginInput)
+	var loginInput utils.LoginInput
 
 	if errAuthIn := c.ShouldBindJSON(&loginInput); errAuthIn != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": errAuthIn.Error()})
+		c.Error(apierror.BadRequest("invalid_input", errAuthIn.Error()))
 		return
 	}
 
@@ -104,48 +119,61 @@ func Login(c *gin.Context) {
 	var errLogin error
 
 	if loginInput.Email != "" {
-		errLogin = initializers.DB.Where("email = ?", loginInput.Email).First(&user).Error
+		user, errLogin = h.Repos.Users.FindByEmail(c.Request.Context(), loginInput.Email)
 	} else if loginInput.UserName != "" {
-		errLogin = initializers.DB.Where("username = ?", loginInput.UserName).First(&user).Error
+		user, errLogin = h.Repos.Users.FindByUserName(c.Request.Context(), loginInput.UserName)
 	} else {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Either username or email must be provided"})
+		c.Error(apierror.BadRequest("invalid_input", "Either username or email must be provided"))
 		return
 	}
 
+	if errors.Is(errLogin, repositories.ErrNotFound) {
+		metrics.Logins.WithLabelValues(metrics.LoginFailed).Inc()
+		c.Error(apierror.Unauthorized("invalid_credentials", "Invalid credentials"))
+		return
+	}
 	if errLogin != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+		c.Error(apierror.Internal("Database query error", errLogin))
 		return
 	}
 
-	if errPassword := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(loginInput.Password)); errPassword != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid password"})
+	if errPassword := checkPassword(c.Request.Context(), user.Password, loginInput.Password); errPassword != nil {
+		metrics.Logins.WithLabelValues(metrics.LoginFailed).Inc()
+		c.Error(apierror.Unauthorized("invalid_credentials", "Invalid password"))
+		return
+	}
+
+	if user.SuspendedAt != nil {
+		metrics.Logins.WithLabelValues(metrics.LoginFailed).Inc()
+		c.Error(apierror.Forbidden("account_suspended", "Account suspended"))
 		return
 	}
 
 	accessTokenClaims := jwt.MapClaims{
 		"id":  user.ID,
-		"exp": time.Now().Add(time.Hour * 1).Unix(),
+		"exp": time.Now().Add(cfg.Auth.AccessTokenTTL).Unix(),
 	}
 	accessToken := jwt.NewWithClaims(jwt.SigningMethodHS256, accessTokenClaims)
-	accessTokenString, err := accessToken.SignedString([]byte(os.Getenv("SECRET")))
+	accessTokenString, err := accessToken.SignedString([]byte(cfg.Auth.Secret))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to generate access token"})
+		c.Error(apierror.Internal("Failed to generate access token", err))
 		return
 	}
 
 	refreshTokenClaims := jwt.MapClaims{
 		"id":  user.ID,
-		"exp": time.Now().Add(time.Hour * 24).Unix(),
+		"exp": time.Now().Add(cfg.Auth.RefreshTokenTTL).Unix(),
 	}
 	refreshToken := jwt.NewWithClaims(jwt.SigningMethodHS256, refreshTokenClaims)
-	refreshTokenString, err := refreshToken.SignedString([]byte(os.Getenv("SECRET")))
+	refreshTokenString, err := refreshToken.SignedString([]byte(cfg.Auth.Secret))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to generate refresh token"})
+		c.Error(apierror.Internal("Failed to generate refresh token", err))
 		return
 	}
 
+	metrics.Logins.WithLabelValues(metrics.LoginSucceeded).Inc()
 	c.SetSameSite(http.SameSiteLaxMode)
-	c.SetCookie("Authorization", accessTokenString, 3600*24, "/", "", false, true)
+	c.SetCookie("Authorization", accessTokenString, int(cfg.Auth.AccessTokenTTL.Seconds()), "/", "", cfg.Auth.CookieSecure, true)
 
 	c.JSON(http.StatusOK, gin.H{
 		"access_token":  accessTokenString,
@@ -153,12 +181,14 @@ func Login(c *gin.Context) {
 	})
 }
 
-func RefreshToken(c *gin.Context) {
+func (h *Handler) RefreshToken(c *gin.Context) {
+	cfg := h.Config
+
 	var request struct {
 		RefreshToken string `json:"refresh_token" binding:"required"`
 	}
 	if err := c.ShouldBindJSON(&request); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.Error(apierror.BadRequest("invalid_input", err.Error()))
 		return
 	}
 
@@ -166,17 +196,17 @@ func RefreshToken(c *gin.Context) {
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 			return nil, jwt.ErrSignatureInvalid
 		}
-		return []byte(os.Getenv("SECRET")), nil
+		return []byte(cfg.Auth.Secret), nil
 	})
 
 	if err != nil || !token.Valid {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+		c.Error(apierror.Unauthorized("invalid_token", "Invalid refresh token"))
 		return
 	}
 
 	claims, ok := token.Claims.(jwt.MapClaims)
 	if !ok {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token claims"})
+		c.Error(apierror.Unauthorized("invalid_token", "Invalid token claims"))
 		return
 	}
 
@@ -184,12 +214,12 @@ func RefreshToken(c *gin.Context) {
 
 	accessTokenClaims := jwt.MapClaims{
 		"id":  userId,
-		"exp": time.Now().Add(time.Hour * 1).Unix(),
+		"exp": time.Now().Add(cfg.Auth.AccessTokenTTL).Unix(),
 	}
 	accessToken := jwt.NewWithClaims(jwt.SigningMethodHS256, accessTokenClaims)
-	accessTokenString, err := accessToken.SignedString([]byte(os.Getenv("SECRET")))
+	accessTokenString, err := accessToken.SignedString([]byte(cfg.Auth.Secret))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to generate new access token"})
+		c.Error(apierror.Internal("Failed to generate new access token", err))
 		return
 	}
 
@@ -198,44 +228,48 @@ func RefreshToken(c *gin.Context) {
 	})
 }
 
-func UserProfile(c *gin.Context) {
+func (h *Handler) UserProfile(c *gin.Context) {
 	user, exists := c.Get("currentUser")
 
 	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		c.Error(apierror.Unauthorized("unauthenticated", "User not found"))
 		return
 	}
 
 	u, ok := user.(models.User)
 	if !ok {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "User data is invalid"})
+		c.Error(apierror.Internal("User data is invalid", fmt.Errorf("currentUser is a %T", user)))
 		return
 	}
 
 	profilePictureURL := ""
 	if u.Picture != "" {
-		profilePictureURL = u.Picture
+		profilePictureURL = h.fileURL(c.Request.Context(), u.Picture)
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"username": u.UserName,
-		"email":    u.Email,
-		"bio":      u.Bio,
-		"picture":  profilePictureURL,
+		"username":         u.UserName,
+		"email":            u.Email,
+		"bio":              u.Bio,
+		"picture":          profilePictureURL,
+		"picture_variants": h.variantURLs(c.Request.Context(), u.Picture, utils.AvatarVariants),
+		"followers_count":  u.FollowersCount,
+		"followings_count": u.FollowingsCount,
+		"tweets_count":     u.TweetsCount,
 	})
 }
 
-func UserUpdate(c *gin.Context) {
+func (h *Handler) UserUpdate(c *gin.Context) {
 	user, exists := c.Get("currentUser")
 	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		c.Error(apierror.Unauthorized("unauthenticated", "Unauthorized"))
 		return
 	}
 
 	currentUser := user.(models.User)
 
-	if err := c.Request.ParseMultipartForm(10 << 20); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to parse form"})
+	if err := c.Request.ParseMultipartForm(h.Config.Uploads.MaxFormMemory); err != nil {
+		c.Error(bodyError(err, apierror.BadRequest("invalid_form", "Failed to parse form")))
 		return
 	}
 
@@ -244,20 +278,23 @@ func UserUpdate(c *gin.Context) {
 	bio := c.Request.FormValue("Bio")
 
 	var filePath string
+	uploaded := false
 	file, err := c.FormFile("Picture")
 	if err == nil {
-		fileName := time.Now().Format("20060102150405") + filepath.Ext(file.Filename)
-		filePath = filepath.Join("uploads/profile_pictures", fileName)
-		if err := c.SaveUploadedFile(file, filePath); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save file"})
+		if !h.checkUpload(c, currentUser, file.Size, currentUser.Picture != "") {
 			return
 		}
+		filePath, _, err = h.saveImage(c.Request.Context(), file, utils.AvatarVariants)
+		if err != nil {
+			abortWithImageError(c, err)
+			return
+		}
+		uploaded = true
+		h.countUpload(c.Request.Context(), currentUser)
 	} else {
 		filePath = currentUser.Picture
 	}
 
-	fmt.Println(username)
-
 	if username != "" {
 		currentUser.UserName = username
 	}
@@ -267,29 +304,43 @@ func UserUpdate(c *gin.Context) {
 	if bio != "" {
 		currentUser.Bio = bio
 	}
+	oldPicture := currentUser.Picture
 	if filePath != "" {
 		currentUser.Picture = filePath
 	}
 
-	if err := initializers.DB.Save(&currentUser).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update user"})
+	if err := h.Repos.Users.Save(c.Request.Context(), &currentUser); err != nil {
+		if uploaded {
+			h.releaseFile(c.Request.Context(), filePath)
+		}
+		c.Error(apierror.Internal("Failed to update user", err))
 		return
 	}
 
+	// Uploading the same image again took another reference to the same
+	// file, so the old one is released even when they are equal.
+	if uploaded {
+		h.releaseFile(c.Request.Context(), oldPicture)
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"user": gin.H{
-			"username": currentUser.UserName,
-			"email":    currentUser.Email,
-			"bio":      currentUser.Bio,
-			"picture":  currentUser.Picture,
+			"username":         currentUser.UserName,
+			"email":            currentUser.Email,
+			"bio":              currentUser.Bio,
+			"picture":          h.fileURL(c.Request.Context(), currentUser.Picture),
+			"picture_variants": h.variantURLs(c.Request.Context(), currentUser.Picture, utils.AvatarVariants),
+			"followers_count":  currentUser.FollowersCount,
+			"followings_count": currentUser.FollowingsCount,
+			"tweets_count":     currentUser.TweetsCount,
 		},
 	})
 }
 
-func ChangePassword(c *gin.Context) {
+func (h *Handler) ChangePassword(c *gin.Context) {
 	user, exists := c.Get("currentUser")
 	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		c.Error(apierror.Unauthorized("unauthenticated", "Unauthorized"))
 		return
 	}
 
@@ -297,27 +348,64 @@ func ChangePassword(c *gin.Context) {
 
 	var input utils.ChangePasswordInput
 	if err := c.ShouldBindJSON(&input); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		c.Error(apierror.BadRequest("invalid_input", "Invalid input"))
 		return
 	}
 
-	err := bcrypt.CompareHashAndPassword([]byte(currentUser.Password), []byte(input.CurrentPassword))
+	err := checkPassword(c.Request.Context(), currentUser.Password, input.CurrentPassword)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Current password is incorrect"})
+		c.Error(apierror.Unauthorized("invalid_credentials", "Current password is incorrect"))
 		return
 	}
 
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(input.NewPassword), bcrypt.DefaultCost)
+	hashedPassword, err := hashPassword(c.Request.Context(), input.NewPassword)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
+		c.Error(apierror.Internal("Failed to hash password", err))
 		return
 	}
 
 	currentUser.Password = string(hashedPassword)
-	if err := initializers.DB.Save(&currentUser).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update password"})
+	if err := h.Repos.Users.Save(c.Request.Context(), &currentUser); err != nil {
+		c.Error(apierror.Internal("Failed to update password", err))
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "Password changed successfully"})
 }
+
+// publicUser returns what other users get to see of u.
+func (h *Handler) publicUser(ctx context.Context, u models.User) utils.PublicUserResponse {
+	return utils.PublicUserResponse{
+		ID:              u.ID,
+		UserName:        u.UserName,
+		Bio:             u.Bio,
+		Picture:         h.fileURL(ctx, u.Picture),
+		PictureVariants: h.variantURLs(ctx, u.Picture, utils.AvatarVariants),
+		FollowersCount:  u.FollowersCount,
+		FollowingsCount: u.FollowingsCount,
+		TweetsCount:     u.TweetsCount,
+	}
+}
+
+// hashPassword hashes password with bcrypt in a span of its own, it is
+// meant to be slow.
+func hashPassword(ctx context.Context, password string) ([]byte, error) {
+	_, span := tracing.Start(ctx, "bcrypt.GenerateFromPassword")
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	tracing.End(span, err)
+	return hash, err
+}
+
+// checkPassword compares password with a bcrypt hash in a span of its own.
+// A wrong password is reported but not recorded as a failure of the span.
+func checkPassword(ctx context.Context, hash, password string) error {
+	_, span := tracing.Start(ctx, "bcrypt.CompareHashAndPassword")
+	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		span.SetAttributes(attribute.Bool("bcrypt.match", false))
+		tracing.End(span, nil)
+	} else {
+		tracing.End(span, err)
+	}
+	return err
+}
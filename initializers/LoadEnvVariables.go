@@ -1,13 +0,0 @@
-package initializers
-
-import (
-	"github.com/joho/godotenv"
-	"log"
-)
-
-func LoadEnVVariables() {
-	err := godotenv.Load()
-	if err != nil {
-		log.Fatal("Error while trying load .env")
-	}
-}
@@ -1,26 +1,46 @@
 package initializers
 
 import (
-	"fmt"
+	"github.com/glebarez/sqlite"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
-	"log"
-	"os"
+	"main/config"
+	"main/logging"
+	"main/metrics"
+	"main/tracing"
 )
 
-var DB *gorm.DB
+func ConnectToDB(cfg *config.Config) (*gorm.DB, error) {
+	dialector := postgres.Open(cfg.DB.DSN())
+	if cfg.DB.Driver == "sqlite" {
+		dialector = sqlite.Open(cfg.DB.DSN())
+	}
 
-func ConnectToDB() {
-	var err error
-	host := os.Getenv("DB_HOST")
-	user := os.Getenv("DB_USER")
-	password := os.Getenv("DB_PASSWORD")
-	dbname := os.Getenv("DB_NAME")
-	port := os.Getenv("DB_PORT")
-	dsn := fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%s sslmode=disable",
-		host, user, password, dbname, port)
-	DB, err = gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	db, err := gorm.Open(dialector, &gorm.Config{Logger: logging.GormLogger{}})
 	if err != nil {
-		log.Fatal("Failed to connect to DB!")
+		return nil, err
+	}
+
+	if err := db.Use(metrics.GormPlugin{}); err != nil {
+		return nil, err
 	}
+	if err := db.Use(tracing.GormPlugin{}); err != nil {
+		return nil, err
+	}
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+	sqlDB.SetMaxOpenConns(cfg.DB.MaxOpenConns)
+	sqlDB.SetMaxIdleConns(cfg.DB.MaxIdleConns)
+	sqlDB.SetConnMaxLifetime(cfg.DB.ConnMaxLifetime)
+	sqlDB.SetConnMaxIdleTime(cfg.DB.ConnMaxIdleTime)
+	if cfg.DB.Driver == "sqlite" {
+		// SQLite allows one writer at a time, and every connection to
+		// ":memory:" would get a database of its own.
+		sqlDB.SetMaxOpenConns(1)
+	}
+
+	return db, nil
 }
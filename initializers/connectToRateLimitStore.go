@@ -0,0 +1,21 @@
+package initializers
+
+import (
+	"github.com/redis/go-redis/v9"
+	"main/config"
+	"main/ratelimit"
+)
+
+// ConnectToRateLimitStore opens the store the rate limiter keeps its
+// buckets in. Connections to Redis are only made once it is used.
+func ConnectToRateLimitStore(cfg *config.Config) (ratelimit.Store, error) {
+	if cfg.RateLimit.Store != "redis" {
+		return ratelimit.NewMemoryStore(), nil
+	}
+
+	options, err := redis.ParseURL(cfg.RateLimit.RedisURL)
+	if err != nil {
+		return nil, err
+	}
+	return ratelimit.NewRedisStore(redis.NewClient(options)), nil
+}
@@ -0,0 +1,38 @@
+package initializers
+
+import (
+	"context"
+	"main/config"
+	"main/storage"
+	"main/tracing"
+	"os"
+)
+
+// ConnectToStorage opens the storage backend selected by the config. The
+// returned URLSigner signs the URLs of files served through the /uploads
+// route. It also creates the local directory partial resumable uploads are
+// kept in until they are finalized and moved to storage.
+func ConnectToStorage(cfg *config.Config) (storage.Storage, *storage.URLSigner, error) {
+	signer := storage.NewURLSigner(cfg.Storage.URLSecret, "/uploads")
+
+	if err := os.MkdirAll(cfg.Storage.ResumableDir, 0750); err != nil {
+		return nil, nil, err
+	}
+
+	if cfg.Storage.Driver == "s3" {
+		store, err := storage.NewS3Storage(context.Background(), storage.S3Options{
+			Endpoint:  cfg.Storage.S3Endpoint,
+			AccessKey: cfg.Storage.S3AccessKey,
+			SecretKey: cfg.Storage.S3SecretKey,
+			Bucket:    cfg.Storage.S3Bucket,
+			Region:    cfg.Storage.S3Region,
+			UseSSL:    cfg.Storage.S3UseSSL,
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+		return tracing.Storage(store), signer, nil
+	}
+
+	return tracing.Storage(storage.NewLocalStorage(cfg.Storage.Path, signer)), signer, nil
+}
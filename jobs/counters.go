@@ -0,0 +1,110 @@
+package jobs
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// counter is a denormalized count column and the query computing its real
+// value, correlated on the row of table being checked.
+type counter struct {
+	table  string
+	column string
+	actual string
+}
+
+var counters = []counter{
+	{"users", "tweets_count", "SELECT count(*) FROM tweets WHERE tweets.author_id = users.id AND tweets.deleted_at IS NULL"},
+	{"users", "followers_count", "SELECT count(*) FROM follow_models WHERE follow_models.following_id = users.id"},
+	{"users", "followings_count", "SELECT count(*) FROM follow_models WHERE follow_models.followed_by_id = users.id"},
+	{"tweets", "likes_count", "SELECT count(*) FROM like_models WHERE like_models.tweet_id = tweets.id"},
+}
+
+// CounterDrift is a counter that didn't match the rows it counts.
+type CounterDrift struct {
+	Table  string
+	Column string
+	ID     uint
+	Stored int64
+	Actual int64
+}
+
+type CounterReport struct {
+	Checked int
+	Drift   []CounterDrift
+}
+
+// StartCounterReconciler reconciles the counters every interval until ctx is
+// cancelled.
+func (r *Runner) StartCounterReconciler(ctx context.Context, interval time.Duration) {
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			report, err := r.ReconcileCounters(ctx)
+			if err != nil {
+				slog.Error("Failed to reconcile counters", "error", err)
+			} else {
+				logCounterReport(report)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// ReconcileCounters recomputes the like, follower, following and tweet
+// counters and fixes the ones that drifted. They are kept up to date by the
+// repositories, so any drift points at a write that bypassed them.
+func (r *Runner) ReconcileCounters(ctx context.Context) (*CounterReport, error) {
+	report := &CounterReport{}
+	db := r.DB.WithContext(ctx)
+
+	for _, counter := range counters {
+		var drifted []struct {
+			ID     uint
+			Stored int64
+			Actual int64
+		}
+		err := db.Raw("SELECT id, stored, actual FROM (SELECT id, " + counter.column + " AS stored, (" + counter.actual + ") AS actual FROM " + counter.table + ") counts WHERE stored <> actual").
+			Scan(&drifted).Error
+		if err != nil {
+			return nil, err
+		}
+		report.Checked++
+
+		for _, row := range drifted {
+			// Recomputed in the update rather than set to row.Actual, so
+			// writes since the select aren't lost.
+			err := db.Exec("UPDATE "+counter.table+" SET "+counter.column+" = ("+counter.actual+") WHERE id = ?", row.ID).Error
+			if err != nil {
+				return report, err
+			}
+			report.Drift = append(report.Drift, CounterDrift{
+				Table:  counter.table,
+				Column: counter.column,
+				ID:     row.ID,
+				Stored: row.Stored,
+				Actual: row.Actual,
+			})
+		}
+	}
+
+	return report, nil
+}
+
+func logCounterReport(report *CounterReport) {
+	for _, drift := range report.Drift {
+		slog.Warn("Fixed drifted counter", "table", drift.Table, "column", drift.Column,
+			"id", drift.ID, "stored", drift.Stored, "actual", drift.Actual)
+	}
+	slog.Info("Reconciled counters", "checked", report.Checked, "fixed", len(report.Drift))
+}
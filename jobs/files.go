@@ -0,0 +1,208 @@
+package jobs
+
+import (
+	"context"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"log/slog"
+	"main/models"
+	"main/storage"
+	"main/utils"
+	"path"
+	"strings"
+	"time"
+)
+
+type FileGCReport struct {
+	DryRun  bool
+	Scanned int
+	Orphans []storage.ObjectInfo
+	Bytes   int64
+	Deleted int
+}
+
+// StartFileGC collects orphan files every interval until ctx is cancelled.
+// In dry-run mode it only logs what would be deleted.
+func (r *Runner) StartFileGC(ctx context.Context, interval, safetyWindow time.Duration, dryRun bool) {
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			report, err := r.CollectOrphanFiles(ctx, safetyWindow, dryRun)
+			if err != nil {
+				slog.Error("Failed to collect orphan files", "error", err)
+			} else {
+				logFileGCReport(report)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// CollectOrphanFiles deletes stored files that no tweet, user or media row
+// references and no blob holds a reference to. Files changed within
+// safetyWindow are never touched, so uploads still in flight are safe.
+func (r *Runner) CollectOrphanFiles(ctx context.Context, safetyWindow time.Duration, dryRun bool) (*FileGCReport, error) {
+	cutoff := time.Now().Add(-safetyWindow)
+
+	referenced, err := r.referencedKeys(ctx, cutoff)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &FileGCReport{DryRun: dryRun}
+	err = r.Storage.Walk(ctx, func(info storage.ObjectInfo) error {
+		report.Scanned++
+		if referenced[info.Key] || info.ModTime.After(cutoff) {
+			return nil
+		}
+		report.Orphans = append(report.Orphans, info)
+		report.Bytes += info.Size
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if dryRun {
+		return report, nil
+	}
+
+	for _, orphan := range report.Orphans {
+		deleted, err := r.deleteOrphan(ctx, orphan.Key, cutoff)
+		if err != nil {
+			slog.Error("Failed to delete orphan file", "key", orphan.Key, "error", err)
+			continue
+		}
+		if deleted {
+			report.Deleted++
+		}
+	}
+
+	return report, nil
+}
+
+// deleteOrphan deletes the file at key unless its blob, or the blob it is a
+// variant of, was referenced again since the scan. A re-upload of the same
+// content finds the file in place and doesn't write it again, so the blob
+// rows stay locked until the file is gone: Store, which takes its reference
+// through them, waits and then finds the file missing and puts it back.
+func (r *Runner) deleteOrphan(ctx context.Context, key string, cutoff time.Time) (bool, error) {
+	deleted := false
+	err := r.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var blobs []models.Blob
+		err := tx.Unscoped().Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("storage_key IN ?", blobKeys(key)).
+			Find(&blobs).Error
+		if err != nil {
+			return err
+		}
+		for _, blob := range blobs {
+			if blob.RefCount > 0 || blob.UpdatedAt.After(cutoff) {
+				return nil
+			}
+		}
+
+		if err := r.Storage.Delete(ctx, key); err != nil {
+			return err
+		}
+		deleted = true
+
+		return tx.Unscoped().
+			Where("storage_key = ? AND ref_count <= 0", key).
+			Delete(&models.Blob{}).Error
+	})
+	return deleted, err
+}
+
+// blobKeys returns key and, if it is the path of an image variant, the key
+// of the image it was made from.
+func blobKeys(key string) []string {
+	keys := []string{key}
+	ext := path.Ext(key)
+	for _, variant := range imageVariants() {
+		suffix := "_" + variant.Name + ext
+		if strings.HasSuffix(key, suffix) {
+			keys = append(keys, strings.TrimSuffix(key, suffix)+ext)
+		}
+	}
+	return keys
+}
+
+func imageVariants() []utils.ImageVariant {
+	return append(append([]utils.ImageVariant{}, utils.AvatarVariants...), utils.TweetMediaVariants...)
+}
+
+// referencedKeys returns every storage key that must be kept: the files of
+// users, of tweets and of their media (those of tweets deleted after cutoff
+// included), blobs that still have references or changed after cutoff, and
+// the image variants of all of them.
+func (r *Runner) referencedKeys(ctx context.Context, cutoff time.Time) (map[string]bool, error) {
+	var values []string
+	db := r.DB.WithContext(ctx)
+
+	// Deleting a tweet releases its files; they are kept for the safety
+	// window like released blobs.
+	tweets := db.Unscoped().Model(&models.Tweet{}).
+		Where("deleted_at IS NULL OR deleted_at > ?", cutoff).
+		Session(&gorm.Session{})
+	var tweetFiles, pictures, mediaPaths, posterPaths, blobKeys []string
+	if err := tweets.Where("file <> ''").Pluck("file", &tweetFiles).Error; err != nil {
+		return nil, err
+	}
+	if err := db.Unscoped().Model(&models.User{}).Where("picture <> ''").Pluck("picture", &pictures).Error; err != nil {
+		return nil, err
+	}
+	media := db.Unscoped().Model(&models.Media{}).
+		Where("tweet_id IS NULL OR tweet_id IN (?)", tweets.Select("id")).
+		Session(&gorm.Session{})
+	if err := media.Pluck("path", &mediaPaths).Error; err != nil {
+		return nil, err
+	}
+	if err := media.Where("poster_path <> ''").Pluck("poster_path", &posterPaths).Error; err != nil {
+		return nil, err
+	}
+	if err := db.Model(&models.Blob{}).Where("ref_count > 0 OR updated_at > ?", cutoff).Pluck("storage_key", &blobKeys).Error; err != nil {
+		return nil, err
+	}
+	values = append(values, tweetFiles...)
+	values = append(values, pictures...)
+	values = append(values, mediaPaths...)
+	values = append(values, posterPaths...)
+	values = append(values, blobKeys...)
+
+	variants := imageVariants()
+
+	keys := make(map[string]bool, len(values)*(len(variants)+1))
+	for _, value := range values {
+		key := utils.StorageKey(value)
+		keys[key] = true
+		for _, variant := range variants {
+			keys[utils.VariantPath(key, variant.Name)] = true
+		}
+	}
+
+	return keys, nil
+}
+
+func logFileGCReport(report *FileGCReport) {
+	if report.DryRun {
+		for _, orphan := range report.Orphans {
+			slog.Info("File GC (dry run): would delete orphan file", "key", orphan.Key, "bytes", orphan.Size)
+		}
+		slog.Info("File GC (dry run): found orphan files", "scanned", report.Scanned,
+			"orphans", len(report.Orphans), "reclaimable_bytes", report.Bytes)
+		return
+	}
+
+	slog.Info("File GC: collected orphan files", "scanned", report.Scanned,
+		"deleted", report.Deleted, "orphans", len(report.Orphans), "bytes", report.Bytes)
+}
@@ -0,0 +1,176 @@
+package jobs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"main/blobs"
+	"main/models"
+	"main/repositories"
+	"main/storage"
+	"main/testdb"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// walkHook runs a function once the scan of the garbage collector is done,
+// before it deletes anything.
+type walkHook struct {
+	storage.Storage
+	afterWalk func()
+}
+
+func (s walkHook) Walk(ctx context.Context, fn func(info storage.ObjectInfo) error) error {
+	if err := s.Storage.Walk(ctx, fn); err != nil {
+		return err
+	}
+	s.afterWalk()
+	return nil
+}
+
+func TestCollectOrphanFilesKeepsReuploadedBlob(t *testing.T) {
+	db := testdb.Open(t)
+	dir := t.TempDir()
+	local := storage.NewLocalStorage(dir, nil)
+	service := blobs.New(db, local)
+	ctx := context.Background()
+	content := []byte("same picture")
+
+	// A blob whose last reference was released long ago.
+	key, err := service.Store(ctx, bytes.NewReader(content), ".jpg", "image/jpeg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := service.Release(ctx, key); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-48 * time.Hour)
+	if err := db.Exec("UPDATE blobs SET updated_at = ?", old).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(filepath.Join(dir, key), old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	// The same content is uploaded again between the scan and the deletion.
+	// The file is still there, so Store doesn't write it.
+	hooked := walkHook{Storage: local, afterWalk: func() {
+		if _, err := service.Store(ctx, bytes.NewReader(content), ".jpg", "image/jpeg"); err != nil {
+			t.Fatal(err)
+		}
+	}}
+	runner := NewRunner(db, hooked, t.TempDir())
+
+	report, err := runner.CollectOrphanFiles(ctx, 24*time.Hour, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Orphans) != 1 || report.Deleted != 0 {
+		t.Fatalf("got %d orphans and %d deleted, want the blob found but kept", len(report.Orphans), report.Deleted)
+	}
+	if _, err := local.Stat(ctx, key); err != nil {
+		t.Fatalf("re-uploaded blob was deleted: %v", err)
+	}
+}
+
+func TestCollectOrphanFilesDeletesReleasedBlob(t *testing.T) {
+	db := testdb.Open(t)
+	dir := t.TempDir()
+	local := storage.NewLocalStorage(dir, nil)
+	service := blobs.New(db, local)
+	ctx := context.Background()
+
+	key, err := service.Store(ctx, bytes.NewReader([]byte("gone")), ".jpg", "image/jpeg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := service.Release(ctx, key); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-48 * time.Hour)
+	if err := db.Exec("UPDATE blobs SET updated_at = ?", old).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(filepath.Join(dir, key), old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := NewRunner(db, local, t.TempDir()).CollectOrphanFiles(ctx, 24*time.Hour, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Deleted != 1 {
+		t.Fatalf("got %d deleted, want 1", report.Deleted)
+	}
+	var count int64
+	db.Table("blobs").Count(&count)
+	if count != 0 {
+		t.Fatalf("got %d blob rows left, want 0", count)
+	}
+}
+
+func TestCollectOrphanFilesDeletesFilesOfDeletedTweets(t *testing.T) {
+	db := testdb.Open(t)
+	dir := t.TempDir()
+	local := storage.NewLocalStorage(dir, nil)
+	service := blobs.New(db, local)
+	repos := repositories.New(db)
+	ctx := context.Background()
+
+	author := models.User{UserName: "author", Email: "author@example.com", Password: "hash"}
+	if err := db.Create(&author).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	// A tweet deleted long ago, and one deleted within the safety window.
+	var keys []string
+	for _, content := range []string{"deleted long ago", "deleted just now"} {
+		key, err := service.Store(ctx, bytes.NewReader([]byte(content)), ".jpg", "image/jpeg")
+		if err != nil {
+			t.Fatal(err)
+		}
+		tweet := models.Tweet{Title: "tweet", Body: content, File: key, AuthorID: author.ID}
+		if err := repos.Tweets.Create(ctx, &tweet, nil); err != nil {
+			t.Fatal(err)
+		}
+		files, err := repos.Tweets.Delete(ctx, &tweet)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, file := range files {
+			if err := service.Release(ctx, file); err != nil {
+				t.Fatal(err)
+			}
+		}
+		keys = append(keys, key)
+	}
+
+	old := time.Now().Add(-48 * time.Hour)
+	if err := db.Exec("UPDATE blobs SET updated_at = ?", old).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Exec("UPDATE tweets SET deleted_at = ? WHERE file = ?", old, keys[0]).Error; err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range keys {
+		if err := os.Chtimes(filepath.Join(dir, key), old, old); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	report, err := NewRunner(db, local, t.TempDir()).CollectOrphanFiles(ctx, 24*time.Hour, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Deleted != 1 {
+		t.Fatalf("got %d deleted, want 1", report.Deleted)
+	}
+	if _, err := local.Stat(ctx, keys[0]); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("file of the tweet deleted long ago: got %v, want it deleted", err)
+	}
+	if _, err := local.Stat(ctx, keys[1]); err != nil {
+		t.Fatalf("file of the tweet deleted just now: %v", err)
+	}
+}
@@ -0,0 +1,70 @@
+package jobs
+
+import (
+	"context"
+	"log/slog"
+	"main/models"
+	"time"
+)
+
+// StartMediaGC deletes uploads that were never attached to a tweet within
+// ttl, checking every interval until ctx is cancelled.
+func (r *Runner) StartMediaGC(ctx context.Context, interval, ttl time.Duration) {
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			if _, err := r.CollectUnattachedMedia(ctx, time.Now().Add(-ttl), false); err != nil {
+				slog.Error("Failed to collect unattached media", "error", err)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// CollectUnattachedMedia removes unattached media uploaded before cutoff and
+// releases their files, which the file garbage collector deletes once nothing
+// else references them. It returns how many media were removed, or would
+// have been in dry-run mode.
+func (r *Runner) CollectUnattachedMedia(ctx context.Context, cutoff time.Time, dryRun bool) (int, error) {
+	db := r.DB.WithContext(ctx)
+	var media []models.Media
+	err := db.Where("tweet_id IS NULL AND created_at < ?", cutoff).Find(&media).Error
+	if err != nil {
+		return 0, err
+	}
+	if dryRun {
+		return len(media), nil
+	}
+
+	collected := 0
+
+	for _, item := range media {
+		result := db.Unscoped().Where("id = ? AND tweet_id IS NULL", item.ID).Delete(&models.Media{})
+		if result.Error != nil {
+			return collected, result.Error
+		}
+		// Attached in the meantime.
+		if result.RowsAffected == 0 {
+			continue
+		}
+		collected++
+
+		if err := r.Blobs.Release(ctx, item.Path); err != nil {
+			return collected, err
+		}
+		if err := r.Blobs.Release(ctx, item.PosterPath); err != nil {
+			return collected, err
+		}
+	}
+
+	return collected, nil
+}
@@ -0,0 +1,58 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"main/models"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// StartResumableGC deletes abandoned resumable uploads every interval until
+// ctx is cancelled.
+func (r *Runner) StartResumableGC(ctx context.Context, interval time.Duration) {
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			if err := r.CollectExpiredUploads(ctx, time.Now()); err != nil {
+				slog.Error("Failed to collect expired uploads", "error", err)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// CollectExpiredUploads removes resumable uploads that expired before now,
+// both the partial file and the row.
+func (r *Runner) CollectExpiredUploads(ctx context.Context, now time.Time) error {
+	db := r.DB.WithContext(ctx)
+	var sessions []models.UploadSession
+	if err := db.Where("expires_at < ?", now).Find(&sessions).Error; err != nil {
+		return err
+	}
+
+	for _, session := range sessions {
+		err := os.Remove(filepath.Join(r.ResumableDir, session.ID))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			slog.Error("Failed to remove partial upload", "id", session.ID, "error", err)
+			continue
+		}
+
+		if err := db.Delete(&session).Error; err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,38 @@
+package jobs
+
+import (
+	"gorm.io/gorm"
+	"main/blobs"
+	"main/search"
+	"main/storage"
+	"sync"
+)
+
+// Runner runs the background jobs against the database and storage it is
+// given.
+type Runner struct {
+	DB           *gorm.DB
+	Storage      storage.Storage
+	Blobs        *blobs.Service
+	Search       *search.Service
+	ResumableDir string
+
+	wg sync.WaitGroup
+}
+
+func NewRunner(db *gorm.DB, store storage.Storage, resumableDir string) *Runner {
+	return &Runner{
+		DB:           db,
+		Storage:      store,
+		Blobs:        blobs.New(db, store),
+		Search:       search.New(db),
+		ResumableDir: resumableDir,
+	}
+}
+
+// Wait blocks until every job started by the Start methods has returned,
+// which they do once their context is cancelled and any run in progress
+// is finished.
+func (r *Runner) Wait() {
+	r.wg.Wait()
+}
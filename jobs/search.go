@@ -0,0 +1,25 @@
+package jobs
+
+import (
+	"context"
+	"gorm.io/gorm"
+	"main/models"
+)
+
+// ReindexSearch re-extracts the hashtags and mentions of every tweet, for
+// when the extraction rules changed or the rows were lost. It returns the
+// number of tweets indexed.
+func (r *Runner) ReindexSearch(ctx context.Context) (int, error) {
+	indexed := 0
+	var tweets []models.Tweet
+	err := r.DB.WithContext(ctx).FindInBatches(&tweets, 500, func(tx *gorm.DB, batch int) error {
+		for _, tweet := range tweets {
+			if err := r.Search.Index(ctx, tweet); err != nil {
+				return err
+			}
+			indexed++
+		}
+		return nil
+	}).Error
+	return indexed, err
+}
@@ -0,0 +1,155 @@
+package jobs
+
+import (
+	"context"
+	"log/slog"
+	"main/models"
+	"math"
+	"sort"
+	"time"
+)
+
+type TrendWindow struct {
+	Name     string
+	Span     time.Duration
+	Baseline time.Duration
+}
+
+// TrendWindows are the sliding windows trends are computed over. Activity in
+// Span is compared against the average rate over the Baseline period that
+// precedes it, so a tag that is always busy doesn't trend just for being busy.
+var TrendWindows = []TrendWindow{
+	{Name: "1h", Span: time.Hour, Baseline: 24 * time.Hour},
+	{Name: "24h", Span: 24 * time.Hour, Baseline: 7 * 24 * time.Hour},
+}
+
+const (
+	minTrendCount = 3
+	maxTrends     = 20
+)
+
+type hashtagCount struct {
+	HashtagID uint
+	Count     int64
+}
+
+func FindTrendWindow(name string) (TrendWindow, bool) {
+	for _, window := range TrendWindows {
+		if window.Name == name {
+			return window, true
+		}
+	}
+	return TrendWindow{}, false
+}
+
+// StartTrends recomputes trends immediately and then every interval until ctx
+// is cancelled.
+func (r *Runner) StartTrends(ctx context.Context, interval time.Duration) {
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			if err := r.ComputeTrends(ctx, time.Now()); err != nil {
+				slog.Error("Failed to compute trends", "error", err)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func (r *Runner) ComputeTrends(ctx context.Context, now time.Time) error {
+	for _, window := range TrendWindows {
+		if err := r.computeWindow(ctx, window, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *Runner) computeWindow(ctx context.Context, window TrendWindow, now time.Time) error {
+	windowStart := now.Add(-window.Span)
+
+	current, err := r.countHashtags(ctx, windowStart, now)
+	if err != nil {
+		return err
+	}
+
+	baseline, err := r.countHashtags(ctx, windowStart.Add(-window.Baseline), windowStart)
+	if err != nil {
+		return err
+	}
+
+	// Number of Span-sized slices in the baseline, used to turn the baseline
+	// count into the count we'd expect in one window.
+	slices := float64(window.Baseline) / float64(window.Span)
+
+	var trends []models.Trend
+	for hashtagID, count := range current {
+		if count < minTrendCount {
+			continue
+		}
+
+		expected := float64(baseline[hashtagID]) / slices
+		score := (float64(count) - expected) / math.Sqrt(expected+1)
+		if score <= 0 {
+			continue
+		}
+
+		trends = append(trends, models.Trend{
+			Window:    window.Name,
+			HashtagID: hashtagID,
+			Count:     count,
+			Score:     score,
+		})
+	}
+
+	sort.Slice(trends, func(i, j int) bool {
+		return trends[i].Score > trends[j].Score
+	})
+	if len(trends) > maxTrends {
+		trends = trends[:maxTrends]
+	}
+
+	tx := r.DB.WithContext(ctx).Begin()
+	if err := tx.Unscoped().Where("trend_window = ?", window.Name).Delete(&models.Trend{}).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	if len(trends) > 0 {
+		if err := tx.Create(&trends).Error; err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit().Error
+}
+
+// countHashtags counts the uses of each hashtag in the tweets posted
+// between from and to. It goes by the date of the tweet rather than of the
+// link, which is recreated whenever the tweet is edited or reindexed.
+func (r *Runner) countHashtags(ctx context.Context, from, to time.Time) (map[uint]int64, error) {
+	var rows []hashtagCount
+	err := r.DB.WithContext(ctx).Model(&models.TweetHashtag{}).
+		Select("tweet_hashtags.hashtag_id, COUNT(*) AS count").
+		Joins("JOIN tweets ON tweets.id = tweet_hashtags.tweet_id AND tweets.deleted_at IS NULL").
+		Where("tweets.created_at >= ? AND tweets.created_at < ?", from, to).
+		Group("tweet_hashtags.hashtag_id").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make(map[uint]int64, len(rows))
+	for _, row := range rows {
+		counts[row.HashtagID] = row.Count
+	}
+	return counts, nil
+}
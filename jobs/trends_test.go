@@ -0,0 +1,52 @@
+package jobs
+
+import (
+	"context"
+	"main/models"
+	"main/search"
+	"main/testdb"
+	"testing"
+	"time"
+)
+
+func TestComputeTrendsCountsByTweetDate(t *testing.T) {
+	db := testdb.Open(t)
+	runner := NewRunner(db, nil, t.TempDir())
+	ctx := context.Background()
+	now := time.Now()
+
+	author := models.User{UserName: "author", Email: "author@example.com", Password: "x"}
+	if err := db.Create(&author).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	post := func(body string, at time.Time) {
+		t.Helper()
+		tweet := models.Tweet{Title: "t", Body: body, AuthorID: author.ID}
+		tweet.CreatedAt = at
+		if err := db.Create(&tweet).Error; err != nil {
+			t.Fatal(err)
+		}
+		// Links are written with the current time, like when an old tweet
+		// is edited or reindexed.
+		if err := search.New(db).SyncHashtags(ctx, tweet); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < 3; i++ {
+		post("#fresh", now.Add(-time.Minute))
+		post("#edited", now.Add(-30*24*time.Hour))
+	}
+
+	if err := runner.ComputeTrends(context.Background(), now); err != nil {
+		t.Fatal(err)
+	}
+
+	var trends []models.Trend
+	if err := db.Preload("Hashtag").Where("trend_window = ?", "1h").Find(&trends).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(trends) != 1 || trends[0].Hashtag.Name != "fresh" || trends[0].Count != 3 {
+		t.Fatalf("got trends %+v, want only fresh with 3 uses", trends)
+	}
+}
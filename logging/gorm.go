@@ -0,0 +1,58 @@
+package logging
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+	"log/slog"
+	"time"
+)
+
+// SlowQuery is how long a query may take before it is logged as a warning.
+const SlowQuery = 200 * time.Millisecond
+
+// GormLogger logs the queries of gorm through the default slog logger, with
+// the fields of the request the query was run for. Failed queries are logged
+// as errors, except for missing records, slow ones as warnings and the rest
+// at debug level.
+type GormLogger struct{}
+
+// ParamsFilter leaves the parameters out of the logged SQL, they hold
+// password hashes and tokens.
+func (GormLogger) ParamsFilter(ctx context.Context, sql string, params ...interface{}) (string, []interface{}) {
+	return sql, nil
+}
+
+func (GormLogger) LogMode(gormlogger.LogLevel) gormlogger.Interface {
+	// The level is the one of the slog logger.
+	return GormLogger{}
+}
+
+func (GormLogger) Info(ctx context.Context, msg string, args ...interface{}) {
+	slog.InfoContext(ctx, fmt.Sprintf(msg, args...))
+}
+
+func (GormLogger) Warn(ctx context.Context, msg string, args ...interface{}) {
+	slog.WarnContext(ctx, fmt.Sprintf(msg, args...))
+}
+
+func (GormLogger) Error(ctx context.Context, msg string, args ...interface{}) {
+	slog.ErrorContext(ctx, fmt.Sprintf(msg, args...))
+}
+
+func (GormLogger) Trace(ctx context.Context, begin time.Time, fc func() (string, int64), err error) {
+	elapsed := time.Since(begin)
+	switch {
+	case err != nil && !errors.Is(err, gorm.ErrRecordNotFound) && !errors.Is(err, context.Canceled):
+		sql, rows := fc()
+		slog.ErrorContext(ctx, "Query failed", "error", err, "sql", sql, "rows", rows, "elapsed", elapsed)
+	case elapsed > SlowQuery:
+		sql, rows := fc()
+		slog.WarnContext(ctx, "Slow query", "sql", sql, "rows", rows, "elapsed", elapsed)
+	case slog.Default().Enabled(ctx, slog.LevelDebug):
+		sql, rows := fc()
+		slog.DebugContext(ctx, "Query", "sql", sql, "rows", rows, "elapsed", elapsed)
+	}
+}
@@ -0,0 +1,109 @@
+package logging
+
+import (
+	"context"
+	"go.opentelemetry.io/otel/trace"
+	"io"
+	"log"
+	"log/slog"
+	"main/config"
+	"os"
+	"strings"
+	"time"
+)
+
+// Request describes the HTTP request being served. It is stored in the
+// request context, and every record logged with that context gets its
+// fields.
+type Request struct {
+	ID    string
+	Route string
+	Start time.Time
+	// UserID is zero until the request is authenticated.
+	UserID uint
+}
+
+type requestKey struct{}
+
+// WithRequest returns a copy of ctx carrying req.
+func WithRequest(ctx context.Context, req *Request) context.Context {
+	return context.WithValue(ctx, requestKey{}, req)
+}
+
+// FromContext returns the request stored in ctx, or nil outside of requests.
+func FromContext(ctx context.Context) *Request {
+	req, _ := ctx.Value(requestKey{}).(*Request)
+	return req
+}
+
+// SetUser records the authenticated user of the request in ctx, if any.
+func SetUser(ctx context.Context, userID uint) {
+	if req := FromContext(ctx); req != nil {
+		req.UserID = userID
+	}
+}
+
+// Setup makes the logger described by cfg the default one, for both slog
+// and the log package.
+func Setup(cfg config.LogConfig) {
+	slog.SetDefault(New(cfg, os.Stderr))
+}
+
+// New returns a logger writing to w at the level and in the format of cfg.
+func New(cfg config.LogConfig, w io.Writer) *slog.Logger {
+	options := &slog.HandlerOptions{Level: ParseLevel(cfg.Level)}
+
+	var handler slog.Handler
+	if cfg.Format == "json" {
+		handler = slog.NewJSONHandler(w, options)
+	} else {
+		handler = slog.NewTextHandler(w, options)
+	}
+	return slog.New(requestHandler{handler})
+}
+
+// ParseLevel returns the level named by level, info if it is unknown.
+func ParseLevel(level string) slog.Level {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(strings.ToUpper(level))); err != nil {
+		return slog.LevelInfo
+	}
+	return l
+}
+
+// StdLogger returns a log.Logger writing to the default slog logger at
+// level, for libraries that want one.
+func StdLogger(level slog.Level) *log.Logger {
+	return slog.NewLogLogger(slog.Default().Handler(), level)
+}
+
+// requestHandler adds the fields of the request and the ID of the trace
+// found in the context of each record.
+type requestHandler struct {
+	slog.Handler
+}
+
+func (h requestHandler) Handle(ctx context.Context, r slog.Record) error {
+	if span := trace.SpanContextFromContext(ctx); span.IsValid() {
+		r.AddAttrs(slog.String("trace_id", span.TraceID().String()))
+	}
+	if req := FromContext(ctx); req != nil {
+		r.AddAttrs(slog.String("request_id", req.ID))
+		if req.UserID != 0 {
+			r.AddAttrs(slog.Uint64("user_id", uint64(req.UserID)))
+		}
+		if req.Route != "" {
+			r.AddAttrs(slog.String("route", req.Route))
+		}
+		r.AddAttrs(slog.Duration("latency", time.Since(req.Start)))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h requestHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return requestHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h requestHandler) WithGroup(name string) slog.Handler {
+	return requestHandler{h.Handler.WithGroup(name)}
+}
@@ -0,0 +1,69 @@
+package metrics
+
+import (
+	"errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"gorm.io/gorm"
+	"time"
+)
+
+const startKey = "metrics:start"
+
+// GormPlugin times every query run through gorm into DBQueryDuration and
+// counts the failed ones, and exports the stats of the connection pool.
+type GormPlugin struct{}
+
+func (GormPlugin) Name() string {
+	return "metrics"
+}
+
+func (GormPlugin) Initialize(db *gorm.DB) error {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	err = Registry.Register(collectors.NewDBStatsCollector(sqlDB, db.Dialector.Name()))
+	if err != nil && !errors.As(err, &prometheus.AlreadyRegisteredError{}) {
+		return err
+	}
+
+	callbacks := db.Callback()
+	return errors.Join(
+		callbacks.Create().Before("*").Register("metrics:before_create", before),
+		callbacks.Create().After("*").Register("metrics:after_create", after("create")),
+		callbacks.Query().Before("*").Register("metrics:before_query", before),
+		callbacks.Query().After("*").Register("metrics:after_query", after("query")),
+		callbacks.Update().Before("*").Register("metrics:before_update", before),
+		callbacks.Update().After("*").Register("metrics:after_update", after("update")),
+		callbacks.Delete().Before("*").Register("metrics:before_delete", before),
+		callbacks.Delete().After("*").Register("metrics:after_delete", after("delete")),
+		callbacks.Row().Before("*").Register("metrics:before_row", before),
+		callbacks.Row().After("*").Register("metrics:after_row", after("row")),
+		callbacks.Raw().Before("*").Register("metrics:before_raw", before),
+		callbacks.Raw().After("*").Register("metrics:after_raw", after("raw")),
+	)
+}
+
+func before(db *gorm.DB) {
+	db.InstanceSet(startKey, time.Now())
+}
+
+func after(operation string) func(db *gorm.DB) {
+	return func(db *gorm.DB) {
+		value, ok := db.InstanceGet(startKey)
+		if !ok {
+			return
+		}
+		start := value.(time.Time)
+
+		table := db.Statement.Table
+		if table == "" {
+			table = "none"
+		}
+		DBQueryDuration.WithLabelValues(operation, table).Observe(time.Since(start).Seconds())
+		if db.Error != nil && !errors.Is(db.Error, gorm.ErrRecordNotFound) {
+			DBQueryErrors.WithLabelValues(operation, table).Inc()
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"net/http"
+)
+
+// Registry holds every metric of the service, along with the Go runtime and
+// process ones.
+var Registry = prometheus.NewRegistry()
+
+var factory = promauto.With(Registry)
+
+// HTTP metrics, labelled with the route template so paths with IDs don't
+// make a series each.
+var (
+	HTTPRequests = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "HTTP requests served, by method, route and status.",
+	}, []string{"method", "route", "status"})
+
+	HTTPRequestDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "Time spent serving HTTP requests, by method, route and status.",
+		Buckets: []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60},
+	}, []string{"method", "route", "status"})
+
+	HTTPRequestsInFlight = factory.NewGauge(prometheus.GaugeOpts{
+		Name: "http_requests_in_flight",
+		Help: "HTTP requests being served.",
+	})
+)
+
+// Database metrics, see GormPlugin.
+var (
+	DBQueryDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "db_query_duration_seconds",
+		Help:    "Time spent running queries, by operation and table.",
+		Buckets: []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+	}, []string{"operation", "table"})
+
+	DBQueryErrors = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "db_query_errors_total",
+		Help: "Queries that failed, by operation and table. Missing records don't count.",
+	}, []string{"operation", "table"})
+)
+
+// Business metrics.
+var (
+	UploadBytes = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "minitwitter_upload_bytes_total",
+		Help: "Bytes received in uploads, by source: form for multipart uploads, resumable for tus chunks.",
+	}, []string{"source"})
+
+	Signups = factory.NewCounter(prometheus.CounterOpts{
+		Name: "minitwitter_signups_total",
+		Help: "Users who signed up.",
+	})
+
+	Logins = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "minitwitter_logins_total",
+		Help: "Login attempts, by result: succeeded or failed.",
+	}, []string{"result"})
+
+	TweetsCreated = factory.NewCounter(prometheus.CounterOpts{
+		Name: "minitwitter_tweets_created_total",
+		Help: "Tweets created.",
+	})
+
+	Likes = factory.NewCounter(prometheus.CounterOpts{
+		Name: "minitwitter_likes_total",
+		Help: "Tweets liked. Liking a tweet again doesn't count.",
+	})
+
+	Follows = factory.NewCounter(prometheus.CounterOpts{
+		Name: "minitwitter_follows_total",
+		Help: "Users followed. Following a user again doesn't count.",
+	})
+)
+
+// Login results.
+const (
+	LoginSucceeded = "succeeded"
+	LoginFailed    = "failed"
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+
+	// Export the series that are known up front at zero, so rates work
+	// from the first increment.
+	Logins.WithLabelValues(LoginSucceeded)
+	Logins.WithLabelValues(LoginFailed)
+	UploadBytes.WithLabelValues("form")
+	UploadBytes.WithLabelValues("resumable")
+}
+
+// Handler serves the metrics in the Prometheus text format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
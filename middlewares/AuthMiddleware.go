@@ -1,31 +1,39 @@
 package middlewares
 
 import (
+	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
-	"main/initializers"
-	"main/models"
-	"net/http"
-	"os"
+	"main/apierror"
+	"main/logging"
+	"main/repositories"
 	"strings"
 	"time"
 )
 
-func CheckAuth(c *gin.Context) {
+// CheckAuth authenticates requests with a bearer token signed with secret
+// and stores the user it belongs to as currentUser.
+func CheckAuth(users repositories.UserRepository, secret string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		checkAuth(c, users, secret)
+	}
+}
+
+func checkAuth(c *gin.Context, users repositories.UserRepository, secret string) {
 
 	authHeader := c.GetHeader("Authorization")
 
 	if authHeader == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header is missing"})
-		c.AbortWithStatus(http.StatusUnauthorized)
+		c.Error(apierror.Unauthorized("missing_token", "Authorization header is missing"))
+		c.Abort()
 		return
 	}
 
 	authToken := strings.Split(authHeader, " ")
 	if len(authToken) != 2 || authToken[0] != "Bearer" {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token format"})
-		c.AbortWithStatus(http.StatusUnauthorized)
+		c.Error(apierror.Unauthorized("invalid_token", "Invalid token format"))
+		c.Abort()
 		return
 	}
 
@@ -34,36 +42,48 @@ func CheckAuth(c *gin.Context) {
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 			return nil, fmt.Errorf("Unexpected signing method: %v", token.Header["alg"])
 		}
-		return []byte(os.Getenv("SECRET")), nil
+		return []byte(secret), nil
 	})
 	if err != nil || !token.Valid {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
-		c.AbortWithStatus(http.StatusUnauthorized)
+		c.Error(apierror.Unauthorized("invalid_token", "Invalid or expired token"))
+		c.Abort()
 		return
 	}
 
 	claims, ok := token.Claims.(jwt.MapClaims)
 	if !ok {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+		c.Error(apierror.Unauthorized("invalid_token", "Invalid token"))
 		c.Abort()
 		return
 	}
 
 	if float64(time.Now().Unix()) > claims["exp"].(float64) {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "token expired"})
-		c.AbortWithStatus(http.StatusUnauthorized)
+		c.Error(apierror.Unauthorized("token_expired", "Token expired"))
+		c.Abort()
 		return
 	}
 
-	var user models.User
-	initializers.DB.Where("ID=?", claims["id"]).Find(&user)
+	userID, _ := claims["id"].(float64)
+	user, err := users.FindByID(c.Request.Context(), uint(userID))
+	if errors.Is(err, repositories.ErrNotFound) {
+		c.Error(apierror.Unauthorized("invalid_token", "User of the token not found"))
+		c.Abort()
+		return
+	}
+	if err != nil {
+		c.Error(apierror.Internal("Database query error", err))
+		c.Abort()
+		return
+	}
 
-	if user.ID == 0 {
-		c.AbortWithStatus(http.StatusUnauthorized)
+	if user.SuspendedAt != nil {
+		c.Error(apierror.Forbidden("account_suspended", "Account suspended"))
+		c.Abort()
 		return
 	}
 
 	c.Set("currentUser", user)
+	logging.SetUser(c.Request.Context(), user.ID)
 
 	c.Next()
 }
@@ -0,0 +1,57 @@
+package middlewares
+
+import (
+	"github.com/gin-gonic/gin"
+	"main/config"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+var (
+	corsAllowedMethods = "GET, POST, PATCH, DELETE, HEAD, OPTIONS"
+	corsAllowedHeaders = "Authorization, Content-Type, X-Request-ID, Upload-Length, Upload-Offset, Upload-Metadata, Tus-Resumable"
+	// Browsers hide response headers from scripts unless they are exposed;
+	// the tus ones are needed to resume uploads.
+	corsExposedHeaders = "Location, Retry-After, X-Request-ID, RateLimit-Limit, RateLimit-Remaining, RateLimit-Reset, RateLimit-Policy, Upload-Offset, Upload-Length, Upload-Expires, Tus-Resumable, Tus-Version, Tus-Extension, Tus-Max-Size"
+)
+
+// CORS answers preflight requests and adds the CORS headers for the origins
+// allowed in cfg. Requests from other origins get no CORS headers, so
+// browsers block them.
+func CORS(cfg config.CORSConfig) gin.HandlerFunc {
+	allowAny := false
+	allowed := make(map[string]bool, len(cfg.AllowedOrigins))
+	for _, origin := range cfg.AllowedOrigins {
+		if origin == "*" {
+			allowAny = true
+		}
+		allowed[strings.TrimSuffix(origin, "/")] = true
+	}
+	maxAge := strconv.Itoa(int(cfg.MaxAge.Seconds()))
+
+	return func(c *gin.Context) {
+		origin := c.GetHeader("Origin")
+		if origin == "" || (!allowAny && !allowed[origin]) {
+			c.Next()
+			return
+		}
+
+		c.Header("Vary", "Origin")
+		c.Header("Access-Control-Allow-Origin", origin)
+		c.Header("Access-Control-Expose-Headers", corsExposedHeaders)
+		if cfg.AllowCredentials {
+			c.Header("Access-Control-Allow-Credentials", "true")
+		}
+
+		if c.Request.Method == http.MethodOptions && c.GetHeader("Access-Control-Request-Method") != "" {
+			c.Header("Access-Control-Allow-Methods", corsAllowedMethods)
+			c.Header("Access-Control-Allow-Headers", corsAllowedHeaders)
+			c.Header("Access-Control-Max-Age", maxAge)
+			c.AbortWithStatus(http.StatusNoContent)
+			return
+		}
+
+		c.Next()
+	}
+}
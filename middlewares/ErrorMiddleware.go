@@ -0,0 +1,93 @@
+package middlewares
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"log/slog"
+	"main/apierror"
+	"main/logging"
+	"net/http"
+)
+
+// Problem is an RFC 7807 problem, extended with the code of the error and
+// the ID of the request that failed.
+type Problem struct {
+	Type      string `json:"type"`
+	Title     string `json:"title"`
+	Status    int    `json:"status"`
+	Detail    string `json:"detail"`
+	Instance  string `json:"instance"`
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+	Details   any    `json:"details,omitempty"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// Errors renders the last error handlers recorded with c.Error as a
+// problem, unless they already replied. Errors that aren't an
+// *apierror.Error are reported as internal ones. It must run after
+// RequestID to get its ID.
+func Errors() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		last := c.Errors.Last()
+		if last == nil || c.Writer.Written() {
+			return
+		}
+
+		var apiErr *apierror.Error
+		if !errors.As(last.Err, &apiErr) {
+			apiErr = apierror.Internal("Internal server error", last.Err)
+		}
+		if apiErr.Status >= http.StatusInternalServerError {
+			slog.ErrorContext(c.Request.Context(), apiErr.Message, "error", apiErr.Err)
+		}
+		WriteProblem(c, apiErr)
+	}
+}
+
+// WriteProblem replies with err as a problem and aborts the request.
+func WriteProblem(c *gin.Context, err *apierror.Error) {
+	problem := Problem{
+		Type:     "about:blank",
+		Title:    http.StatusText(err.Status),
+		Status:   err.Status,
+		Detail:   err.Message,
+		Instance: c.Request.URL.Path,
+		Code:     err.Code,
+		Message:  err.Message,
+		Details:  err.Details,
+	}
+	if req := logging.FromContext(c.Request.Context()); req != nil {
+		problem.RequestID = req.ID
+	}
+
+	c.Abort()
+	c.Render(err.Status, problemJSON{problem})
+}
+
+// problemJSON renders JSON with the application/problem+json content type.
+type problemJSON struct {
+	Problem Problem
+}
+
+func (r problemJSON) Render(w http.ResponseWriter) error {
+	r.WriteContentType(w)
+	return json.NewEncoder(w).Encode(r.Problem)
+}
+
+func (r problemJSON) WriteContentType(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/problem+json")
+}
+
+// NoRoute replies to requests matching no route.
+func NoRoute(c *gin.Context) {
+	c.Error(apierror.NotFound("route_not_found", "Route not found"))
+}
+
+// NoMethod replies to requests for a route that doesn't accept their method.
+func NoMethod(c *gin.Context) {
+	c.Error(apierror.New(http.StatusMethodNotAllowed, "method_not_allowed", "Method not allowed"))
+}
@@ -0,0 +1,44 @@
+package middlewares
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"io"
+	"log/slog"
+	"main/apierror"
+	"net/http"
+	"runtime/debug"
+)
+
+// AccessLog logs every request once it is served, as an error if it failed
+// on the server side. It must run after RequestID to get its fields.
+func AccessLog() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		level := slog.LevelInfo
+		if c.Writer.Status() >= http.StatusInternalServerError {
+			level = slog.LevelError
+		}
+		slog.Log(c.Request.Context(), level, "Request",
+			"method", c.Request.Method,
+			"path", c.Request.URL.Path,
+			"status", c.Writer.Status(),
+			"size", c.Writer.Size(),
+			"client_ip", c.ClientIP(),
+		)
+	}
+}
+
+// Recovery turns panics into internal errors and logs them with their
+// stack. It must run after Errors for them to be rendered.
+func Recovery() gin.HandlerFunc {
+	return gin.CustomRecoveryWithWriter(io.Discard, func(c *gin.Context, err any) {
+		slog.ErrorContext(c.Request.Context(), "Panic serving request",
+			"error", fmt.Sprint(err),
+			"stack", string(debug.Stack()),
+		)
+		c.Error(apierror.Internal("Internal server error", fmt.Errorf("panic: %v", err)))
+		c.Abort()
+	})
+}
@@ -0,0 +1,49 @@
+package middlewares
+
+import (
+	"crypto/subtle"
+	"github.com/gin-gonic/gin"
+	"main/apierror"
+	"main/metrics"
+	"strconv"
+	"time"
+)
+
+// Metrics records the count and duration of every request. Requests that
+// match no route are grouped under one label, so scanners can't make up
+// new series.
+func Metrics() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		metrics.HTTPRequestsInFlight.Inc()
+		defer metrics.HTTPRequestsInFlight.Dec()
+
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		status := strconv.Itoa(c.Writer.Status())
+		metrics.HTTPRequests.WithLabelValues(c.Request.Method, route, status).Inc()
+		metrics.HTTPRequestDuration.WithLabelValues(c.Request.Method, route, status).Observe(time.Since(start).Seconds())
+	}
+}
+
+// MetricsToken only lets requests bearing token through. Any request goes
+// through when token is empty.
+func MetricsToken(token string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if token == "" {
+			c.Next()
+			return
+		}
+
+		if subtle.ConstantTimeCompare([]byte(c.GetHeader("Authorization")), []byte("Bearer "+token)) != 1 {
+			c.Error(apierror.Unauthorized("invalid_metrics_token", "Invalid metrics token"))
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,66 @@
+package middlewares
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"log/slog"
+	"main/apierror"
+	"main/models"
+	"main/ratelimit"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RateLimit lets requests through while the client has tokens left in its
+// bucket for policy, and fails them with 429 otherwise. Clients are the
+// current user on authenticated routes, where it must run after CheckAuth,
+// and the IP address elsewhere. The state of the bucket is reported in the
+// RateLimit-* headers. Requests go through if the store fails, limits aren't
+// worth an outage.
+func RateLimit(store ratelimit.Store, policy ratelimit.Policy) gin.HandlerFunc {
+	if store == nil || policy.Limit == 0 {
+		return func(c *gin.Context) {
+			c.Next()
+		}
+	}
+
+	policyHeader := fmt.Sprintf("%d;w=%d", policy.Limit, int(policy.Period.Seconds()))
+
+	return func(c *gin.Context) {
+		key := "ip:" + c.ClientIP()
+		if user, ok := c.Get("currentUser"); ok {
+			if userModel, ok := user.(models.User); ok {
+				key = "user:" + strconv.FormatUint(uint64(userModel.ID), 10)
+			}
+		}
+
+		res, err := store.Take(c.Request.Context(), key, policy)
+		if err != nil {
+			slog.ErrorContext(c.Request.Context(), "Rate limit store failed, letting the request through",
+				"policy", policy.Name, "error", err)
+			c.Next()
+			return
+		}
+
+		c.Header("RateLimit-Policy", policyHeader)
+		c.Header("RateLimit-Limit", strconv.Itoa(res.Limit))
+		c.Header("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+		c.Header("RateLimit-Reset", ceilSeconds(res.Reset))
+
+		if !res.Allowed {
+			c.Header("Retry-After", ceilSeconds(res.RetryAfter))
+			c.Error(apierror.New(http.StatusTooManyRequests, "rate_limited", "Too many requests, try again later"))
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// ceilSeconds formats d as whole seconds, rounded up so clients don't come
+// back too early.
+func ceilSeconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
@@ -0,0 +1,43 @@
+package middlewares
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"main/logging"
+	"time"
+)
+
+const requestIDHeader = "X-Request-ID"
+
+// RequestID gives every request an ID, the one sent in X-Request-ID by a
+// proxy in front of the server or a new one, and echoes it in the response.
+// The ID, the route and the user are attached to everything logged with the
+// request context.
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(requestIDHeader)
+		if !validRequestID(id) {
+			id = uuid.NewString()
+		}
+		c.Header(requestIDHeader, id)
+
+		req := &logging.Request{ID: id, Route: c.FullPath(), Start: time.Now()}
+		c.Request = c.Request.WithContext(logging.WithRequest(c.Request.Context(), req))
+
+		c.Next()
+	}
+}
+
+// validRequestID accepts up to 128 printable ASCII characters, so a client
+// can't break log lines with what it sends.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
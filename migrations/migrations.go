@@ -0,0 +1,404 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Migrations are SQL files named <version>_<name>.up.sql and
+// <version>_<name>.down.sql, one directory per database.
+//
+//go:embed postgres/*.sql sqlite/*.sql
+var files embed.FS
+
+// lockKey identifies the Postgres advisory lock taken while migrating, so
+// replicas starting together don't migrate twice.
+const lockKey = 4243171101
+
+var fileName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// addColumn matches the ALTER TABLE ... ADD COLUMN IF NOT EXISTS statements
+// of a script, which SQLite doesn't understand.
+var addColumn = regexp.MustCompile(`(?im)^ALTER TABLE (\w+) ADD COLUMN IF NOT EXISTS (\w+)([^;]*);`)
+
+// ErrPending is returned by Check when the schema isn't up to date.
+var ErrPending = errors.New("database schema is not up to date")
+
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+	// reversible is set when there is a down file, even an empty one.
+	reversible bool
+}
+
+type Status struct {
+	Migration
+	AppliedAt *time.Time
+}
+
+// Migrator applies the migrations of one database.
+type Migrator struct {
+	db         *sql.DB
+	dialect    string
+	migrations []Migration
+}
+
+func New(db *gorm.DB) (*Migrator, error) {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+
+	dialect := db.Dialector.Name()
+	migrations, err := load(files, dialect)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Migrator{db: sqlDB, dialect: dialect, migrations: migrations}, nil
+}
+
+func load(fsys fs.FS, dialect string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dialect)
+	if err != nil {
+		return nil, fmt.Errorf("no migrations for %s: %w", dialect, err)
+	}
+
+	byVersion := make(map[int64]*Migration)
+	for _, entry := range entries {
+		match := fileName.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("unexpected migration file %s", entry.Name())
+		}
+		version, _ := strconv.ParseInt(match[1], 10, 64)
+		data, err := fs.ReadFile(fsys, path.Join(dialect, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = migration
+		} else if migration.Name != match[2] {
+			return nil, fmt.Errorf("migration %d has two names: %s and %s", version, migration.Name, match[2])
+		}
+		if match[3] == "up" {
+			migration.Up = string(data)
+		} else {
+			migration.Down = string(data)
+			migration.reversible = true
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// placeholder returns the n-th (1-based) bind parameter.
+func (m *Migrator) placeholder(n int) string {
+	if m.dialect == "postgres" {
+		return "$" + strconv.Itoa(n)
+	}
+	return "?"
+}
+
+// prepare takes the migration lock and creates the schema_migrations table
+// if needed. The returned function releases the lock.
+func (m *Migrator) prepare(ctx context.Context) (func(), error) {
+	unlock, err := m.lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.ensureTable(ctx); err != nil {
+		unlock()
+		return nil, err
+	}
+	return unlock, nil
+}
+
+func (m *Migrator) ensureTable(ctx context.Context) error {
+	_, err := m.db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version bigint PRIMARY KEY,
+		name text NOT NULL,
+		applied_at timestamp NOT NULL
+	)`)
+	return err
+}
+
+// lock serializes migrations across processes until the returned function
+// is called. SQLite has a single writer anyway, so only Postgres takes an
+// advisory lock.
+func (m *Migrator) lock(ctx context.Context) (func(), error) {
+	if m.dialect != "postgres" {
+		return func() {}, nil
+	}
+
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", lockKey); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return func() {
+		conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", lockKey)
+		conn.Close()
+	}, nil
+}
+
+func (m *Migrator) applied(ctx context.Context) (map[int64]time.Time, error) {
+	rows, err := m.db.QueryContext(ctx, "SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[int64]time.Time)
+	for rows.Next() {
+		var version int64
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		applied[version] = appliedAt
+	}
+	return applied, rows.Err()
+}
+
+// Status lists every migration and when it was applied.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	unlock, err := m.prepare(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]Status, 0, len(m.migrations))
+	for _, migration := range m.migrations {
+		status := Status{Migration: migration}
+		if appliedAt, ok := applied[migration.Version]; ok {
+			status.AppliedAt = &appliedAt
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// Up applies up to n pending migrations, or all of them if n is 0, each in a
+// transaction of its own. It returns the migrations it applied.
+func (m *Migrator) Up(ctx context.Context, n int) ([]Migration, error) {
+	unlock, err := m.prepare(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+	for _, migration := range m.migrations {
+		if n > 0 && len(done) == n {
+			break
+		}
+		if _, ok := applied[migration.Version]; ok {
+			continue
+		}
+
+		insert := fmt.Sprintf("INSERT INTO schema_migrations (version, name, applied_at) VALUES (%s, %s, %s)",
+			m.placeholder(1), m.placeholder(2), m.placeholder(3))
+		err := m.inTx(ctx, migration.Up, insert, migration.Version, migration.Name, time.Now().UTC())
+		if err != nil {
+			return done, fmt.Errorf("applying %d_%s: %w", migration.Version, migration.Name, err)
+		}
+		done = append(done, migration)
+	}
+	return done, nil
+}
+
+// Down reverts the last n applied migrations, newest first. It returns the
+// migrations it reverted.
+func (m *Migrator) Down(ctx context.Context, n int) ([]Migration, error) {
+	unlock, err := m.prepare(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+	for i := len(m.migrations) - 1; i >= 0 && len(done) < n; i-- {
+		migration := m.migrations[i]
+		if _, ok := applied[migration.Version]; !ok {
+			continue
+		}
+		if !migration.reversible {
+			return done, fmt.Errorf("migration %d_%s can't be reverted, it has no down file", migration.Version, migration.Name)
+		}
+
+		remove := "DELETE FROM schema_migrations WHERE version = " + m.placeholder(1)
+		if err := m.inTx(ctx, migration.Down, remove, migration.Version); err != nil {
+			return done, fmt.Errorf("reverting %d_%s: %w", migration.Version, migration.Name, err)
+		}
+		done = append(done, migration)
+	}
+	return done, nil
+}
+
+// inTx runs a migration script and the statement recording it in one
+// transaction.
+func (m *Migrator) inTx(ctx context.Context, script, record string, args ...interface{}) error {
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := m.exec(ctx, tx, script); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, record, args...); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// exec runs a migration script. On SQLite it runs the script up to each
+// ADD COLUMN IF NOT EXISTS, then adds the column only if the table doesn't
+// have it yet.
+func (m *Migrator) exec(ctx context.Context, tx *sql.Tx, script string) error {
+	if m.dialect == "sqlite" {
+		for {
+			match := addColumn.FindStringSubmatchIndex(script)
+			if match == nil {
+				break
+			}
+			if err := execScript(ctx, tx, script[:match[0]]); err != nil {
+				return err
+			}
+
+			table, column := script[match[2]:match[3]], script[match[4]:match[5]]
+			var exists bool
+			err := tx.QueryRowContext(ctx, "SELECT count(*) > 0 FROM pragma_table_info(?) WHERE name = ?", table, column).Scan(&exists)
+			if err != nil {
+				return err
+			}
+			if !exists {
+				statement := "ALTER TABLE " + table + " ADD COLUMN " + column + script[match[6]:match[7]]
+				if _, err := tx.ExecContext(ctx, statement); err != nil {
+					return err
+				}
+			}
+			script = script[match[1]:]
+		}
+	}
+	return execScript(ctx, tx, script)
+}
+
+func execScript(ctx context.Context, tx *sql.Tx, script string) error {
+	if strings.TrimSpace(script) == "" {
+		return nil
+	}
+	_, err := tx.ExecContext(ctx, script)
+	return err
+}
+
+// Check returns ErrPending if any migration hasn't been applied yet, so the
+// server doesn't start against a schema it doesn't know.
+func (m *Migrator) Check(ctx context.Context) error {
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		return err
+	}
+
+	var pending []string
+	for _, status := range statuses {
+		if status.AppliedAt == nil {
+			pending = append(pending, fmt.Sprintf("%d_%s", status.Version, status.Name))
+		}
+	}
+	if len(pending) > 0 {
+		return fmt.Errorf("%w: %s pending, run the migrate up command", ErrPending, strings.Join(pending, ", "))
+	}
+	return nil
+}
+
+// Create writes empty up and down files for a new migration for every
+// database, in the migrations source directory dir. The files are embedded
+// in the binary, so it has to be rebuilt to pick them up.
+func Create(dir, name string) ([]string, error) {
+	if !regexp.MustCompile(`^\w+$`).MatchString(name) {
+		return nil, fmt.Errorf("migration name %q must only contain letters, digits and underscores", name)
+	}
+
+	source := os.DirFS(dir)
+	var dialects []string
+	entries, err := fs.ReadDir(source, ".")
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			dialects = append(dialects, entry.Name())
+		}
+	}
+
+	var version int64
+	for _, dialect := range dialects {
+		migrations, err := load(source, dialect)
+		if err != nil {
+			return nil, err
+		}
+		if len(migrations) > 0 {
+			version = max(version, migrations[len(migrations)-1].Version)
+		}
+	}
+	version++
+
+	var created []string
+	for _, dialect := range dialects {
+		for _, direction := range []string{"up", "down"} {
+			file := filepath.Join(dir, dialect, fmt.Sprintf("%04d_%s.%s.sql", version, name, direction))
+			f, err := os.OpenFile(file, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+			if err != nil {
+				return created, err
+			}
+			f.Close()
+			created = append(created, file)
+		}
+	}
+	return created, nil
+}
@@ -0,0 +1,147 @@
+package migrations_test
+
+import (
+	"context"
+	"gorm.io/gorm"
+	"main/initializers"
+	"main/migrations"
+	"main/testdb"
+	"testing"
+)
+
+// The models as the first release created them with AutoMigrate.
+
+type baselineUser struct {
+	gorm.Model
+	UserName string `gorm:"column:username;unique"`
+	Email    string `gorm:"unique"`
+	Password string `gorm:"column:password;not null"`
+	Bio      string
+	Picture  string
+	Tweets   []baselineTweet `gorm:"foreignKey:AuthorID"`
+}
+
+func (baselineUser) TableName() string { return "users" }
+
+type baselineTweet struct {
+	gorm.Model
+	Title    string `gorm:"column:title;not null"`
+	Body     string `gorm:"column:body;not null"`
+	File     string
+	AuthorID uint
+	Author   baselineUser `gorm:"foreignKey:AuthorID"`
+}
+
+func (baselineTweet) TableName() string { return "tweets" }
+
+type baselineFollow struct {
+	gorm.Model
+	Following    baselineUser
+	FollowingID  uint
+	FollowedBy   baselineUser
+	FollowedByID uint
+}
+
+func (baselineFollow) TableName() string { return "follow_models" }
+
+type baselineLike struct {
+	gorm.Model
+	User    baselineUser
+	UserID  uint
+	Tweet   baselineTweet
+	TweetID uint
+}
+
+func (baselineLike) TableName() string { return "like_models" }
+
+// mediaBeforeVideos is the media table as AutoMigrate created it before
+// videos were supported.
+type mediaBeforeVideos struct {
+	gorm.Model
+	OwnerID  uint  `gorm:"index"`
+	TweetID  *uint `gorm:"index"`
+	Position int
+	Path     string `gorm:"not null"`
+	Kind     string `gorm:"not null"`
+	MimeType string
+	Size     int64
+	Width    int
+	Height   int
+	AltText  string
+}
+
+func (mediaBeforeVideos) TableName() string { return "media" }
+
+func TestUpAdoptsAutoMigratedDatabase(t *testing.T) {
+	db, err := initializers.ConnectToDB(testdb.Config())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+
+	if err := db.AutoMigrate(&baselineUser{}, &baselineTweet{}, &baselineFollow{}, &baselineLike{}, &mediaBeforeVideos{}); err != nil {
+		t.Fatal(err)
+	}
+	alice := baselineUser{UserName: "alice", Email: "alice@example.com", Password: "hash"}
+	bob := baselineUser{UserName: "bob", Email: "bob@example.com", Password: "hash"}
+	for _, user := range []*baselineUser{&alice, &bob} {
+		if err := db.Create(user).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	tweet := baselineTweet{Title: "Hello", Body: "world", AuthorID: alice.ID}
+	if err := db.Create(&tweet).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(&baselineFollow{FollowingID: alice.ID, FollowedByID: bob.ID}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(&baselineLike{UserID: bob.ID, TweetID: tweet.ID}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	migrator, err := migrations.New(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if _, err := migrator.Up(ctx, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := migrator.Check(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, column := range [][2]string{
+		{"users", "role"},
+		{"users", "followers_count"},
+		{"media", "duration_ms"},
+		{"media", "poster_path"},
+		{"blobs", "ref_count"},
+	} {
+		var exists bool
+		err := db.Raw("SELECT count(*) > 0 FROM pragma_table_info(?) WHERE name = ?", column[0], column[1]).Scan(&exists).Error
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !exists {
+			t.Errorf("%s has no %s column", column[0], column[1])
+		}
+	}
+
+	var user struct {
+		Role           string
+		FollowersCount int64
+		TweetsCount    int64
+	}
+	if err := db.Table("users").Where("id = ?", alice.ID).Take(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	if user.Role != "user" || user.FollowersCount != 1 || user.TweetsCount != 1 {
+		t.Fatalf("got role %q, %d followers and %d tweets, want user, 1 and 1", user.Role, user.FollowersCount, user.TweetsCount)
+	}
+}
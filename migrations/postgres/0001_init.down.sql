@@ -0,0 +1,11 @@
+DROP TABLE IF EXISTS upload_sessions;
+DROP TABLE IF EXISTS blobs;
+DROP TABLE IF EXISTS media;
+DROP TABLE IF EXISTS mentions;
+DROP TABLE IF EXISTS trends;
+DROP TABLE IF EXISTS tweet_hashtags;
+DROP TABLE IF EXISTS hashtags;
+DROP TABLE IF EXISTS like_models;
+DROP TABLE IF EXISTS follow_models;
+DROP TABLE IF EXISTS tweets;
+DROP TABLE IF EXISTS users;
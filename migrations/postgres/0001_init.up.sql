@@ -0,0 +1,155 @@
+-- Initial schema, as gorm's AutoMigrate used to create it. Everything is
+-- created only if missing so databases that were set up by AutoMigrate
+-- can be adopted by running this migration. AutoMigrate also added columns
+-- to tables created by earlier releases, those are added if missing too.
+
+CREATE TABLE IF NOT EXISTS users (
+    id bigserial PRIMARY KEY,
+    created_at timestamptz,
+    updated_at timestamptz,
+    deleted_at timestamptz,
+    username text CONSTRAINT uni_users_username UNIQUE,
+    email text CONSTRAINT uni_users_email UNIQUE,
+    password text NOT NULL,
+    bio text,
+    picture text,
+    role text NOT NULL DEFAULT 'user'
+);
+CREATE INDEX IF NOT EXISTS idx_users_deleted_at ON users (deleted_at);
+-- Added after the table was first created.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS role text NOT NULL DEFAULT 'user';
+
+CREATE TABLE IF NOT EXISTS tweets (
+    id bigserial PRIMARY KEY,
+    created_at timestamptz,
+    updated_at timestamptz,
+    deleted_at timestamptz,
+    title text NOT NULL,
+    body text NOT NULL,
+    file text,
+    author_id bigint CONSTRAINT fk_users_tweets REFERENCES users (id)
+);
+CREATE INDEX IF NOT EXISTS idx_tweets_deleted_at ON tweets (deleted_at);
+
+CREATE TABLE IF NOT EXISTS follow_models (
+    id bigserial PRIMARY KEY,
+    created_at timestamptz,
+    updated_at timestamptz,
+    deleted_at timestamptz,
+    following_id bigint CONSTRAINT fk_follow_models_following REFERENCES users (id),
+    followed_by_id bigint CONSTRAINT fk_follow_models_followed_by REFERENCES users (id)
+);
+CREATE INDEX IF NOT EXISTS idx_follow_models_deleted_at ON follow_models (deleted_at);
+
+CREATE TABLE IF NOT EXISTS like_models (
+    id bigserial PRIMARY KEY,
+    created_at timestamptz,
+    updated_at timestamptz,
+    deleted_at timestamptz,
+    user_id bigint CONSTRAINT fk_like_models_user REFERENCES users (id),
+    tweet_id bigint CONSTRAINT fk_like_models_tweet REFERENCES tweets (id)
+);
+CREATE INDEX IF NOT EXISTS idx_like_models_deleted_at ON like_models (deleted_at);
+
+CREATE TABLE IF NOT EXISTS hashtags (
+    id bigserial PRIMARY KEY,
+    created_at timestamptz,
+    updated_at timestamptz,
+    deleted_at timestamptz,
+    name text NOT NULL
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_hashtags_name ON hashtags (name);
+CREATE INDEX IF NOT EXISTS idx_hashtags_deleted_at ON hashtags (deleted_at);
+
+CREATE TABLE IF NOT EXISTS tweet_hashtags (
+    id bigserial PRIMARY KEY,
+    created_at timestamptz,
+    updated_at timestamptz,
+    deleted_at timestamptz,
+    tweet_id bigint CONSTRAINT fk_tweet_hashtags_tweet REFERENCES tweets (id),
+    hashtag_id bigint CONSTRAINT fk_tweet_hashtags_hashtag REFERENCES hashtags (id)
+);
+CREATE INDEX IF NOT EXISTS idx_tweet_hashtags_deleted_at ON tweet_hashtags (deleted_at);
+CREATE INDEX IF NOT EXISTS idx_tweet_hashtags_tweet_id ON tweet_hashtags (tweet_id);
+CREATE INDEX IF NOT EXISTS idx_tweet_hashtags_hashtag_id ON tweet_hashtags (hashtag_id);
+
+CREATE TABLE IF NOT EXISTS trends (
+    id bigserial PRIMARY KEY,
+    created_at timestamptz,
+    updated_at timestamptz,
+    deleted_at timestamptz,
+    trend_window text NOT NULL,
+    hashtag_id bigint CONSTRAINT fk_trends_hashtag REFERENCES hashtags (id),
+    count bigint,
+    score decimal
+);
+CREATE INDEX IF NOT EXISTS idx_trends_window ON trends (trend_window);
+CREATE INDEX IF NOT EXISTS idx_trends_deleted_at ON trends (deleted_at);
+
+CREATE TABLE IF NOT EXISTS mentions (
+    id bigserial PRIMARY KEY,
+    created_at timestamptz,
+    updated_at timestamptz,
+    deleted_at timestamptz,
+    tweet_id bigint CONSTRAINT fk_mentions_tweet REFERENCES tweets (id),
+    user_id bigint CONSTRAINT fk_mentions_user REFERENCES users (id),
+    start_offset bigint,
+    end_offset bigint
+);
+CREATE INDEX IF NOT EXISTS idx_mentions_tweet_id ON mentions (tweet_id);
+CREATE INDEX IF NOT EXISTS idx_mentions_user_id ON mentions (user_id);
+CREATE INDEX IF NOT EXISTS idx_mentions_deleted_at ON mentions (deleted_at);
+
+CREATE TABLE IF NOT EXISTS media (
+    id bigserial PRIMARY KEY,
+    created_at timestamptz,
+    updated_at timestamptz,
+    deleted_at timestamptz,
+    owner_id bigint CONSTRAINT fk_media_owner REFERENCES users (id),
+    tweet_id bigint CONSTRAINT fk_tweets_media REFERENCES tweets (id),
+    position bigint,
+    path text NOT NULL,
+    kind text NOT NULL,
+    mime_type text,
+    size bigint,
+    width bigint,
+    height bigint,
+    alt_text text,
+    duration_ms bigint,
+    poster_path text
+);
+CREATE INDEX IF NOT EXISTS idx_media_owner_id ON media (owner_id);
+CREATE INDEX IF NOT EXISTS idx_media_tweet_id ON media (tweet_id);
+CREATE INDEX IF NOT EXISTS idx_media_deleted_at ON media (deleted_at);
+-- Added with videos, after the table was first created.
+ALTER TABLE media ADD COLUMN IF NOT EXISTS duration_ms bigint;
+ALTER TABLE media ADD COLUMN IF NOT EXISTS poster_path text;
+
+CREATE TABLE IF NOT EXISTS blobs (
+    id bigserial PRIMARY KEY,
+    created_at timestamptz,
+    updated_at timestamptz,
+    deleted_at timestamptz,
+    hash text NOT NULL,
+    storage_key text NOT NULL,
+    size bigint,
+    mime_type text,
+    ref_count bigint NOT NULL DEFAULT 0
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_blobs_hash ON blobs (hash);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_blobs_key ON blobs (storage_key);
+CREATE INDEX IF NOT EXISTS idx_blobs_deleted_at ON blobs (deleted_at);
+
+CREATE TABLE IF NOT EXISTS upload_sessions (
+    id varchar(36) PRIMARY KEY,
+    created_at timestamptz,
+    updated_at timestamptz,
+    owner_id bigint CONSTRAINT fk_upload_sessions_owner REFERENCES users (id),
+    length bigint,
+    upload_offset bigint,
+    file_name text,
+    file_type text,
+    expires_at timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_upload_sessions_owner_id ON upload_sessions (owner_id);
+CREATE INDEX IF NOT EXISTS idx_upload_sessions_expires_at ON upload_sessions (expires_at);
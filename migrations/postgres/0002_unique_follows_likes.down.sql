@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS idx_like_models_pair;
+ALTER TABLE like_models ADD COLUMN deleted_at timestamptz;
+CREATE INDEX idx_like_models_deleted_at ON like_models (deleted_at);
+
+DROP INDEX IF EXISTS idx_follow_models_pair;
+ALTER TABLE follow_models ADD COLUMN deleted_at timestamptz;
+CREATE INDEX idx_follow_models_deleted_at ON follow_models (deleted_at);
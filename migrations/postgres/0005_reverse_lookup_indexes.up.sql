@@ -0,0 +1,6 @@
+-- The pair indexes only help lookups by follower and by liking user.
+-- Listing followers, counting likes and counting a user's tweets, as the
+-- counter reconciliation does for every row, need these.
+CREATE INDEX IF NOT EXISTS idx_follow_models_following_id ON follow_models (following_id);
+CREATE INDEX IF NOT EXISTS idx_like_models_tweet_id ON like_models (tweet_id);
+CREATE INDEX IF NOT EXISTS idx_tweets_author_id ON tweets (author_id);
@@ -0,0 +1,20 @@
+-- Notifications of mentions. Mentions made before are recorded as read,
+-- so reindexing tweets doesn't notify them all at once.
+
+CREATE TABLE notifications (
+    id bigserial PRIMARY KEY,
+    created_at timestamptz,
+    user_id bigint NOT NULL CONSTRAINT fk_notifications_user REFERENCES users (id),
+    actor_id bigint NOT NULL CONSTRAINT fk_notifications_actor REFERENCES users (id),
+    tweet_id bigint NOT NULL CONSTRAINT fk_notifications_tweet REFERENCES tweets (id),
+    kind text NOT NULL,
+    read_at timestamptz
+);
+CREATE UNIQUE INDEX idx_notifications_unique ON notifications (user_id, tweet_id, kind);
+CREATE INDEX idx_notifications_tweet_id ON notifications (tweet_id);
+
+INSERT INTO notifications (created_at, user_id, actor_id, tweet_id, kind, read_at)
+SELECT min(mentions.created_at), mentions.user_id, tweets.author_id, mentions.tweet_id, 'mention', CURRENT_TIMESTAMP
+FROM mentions JOIN tweets ON tweets.id = mentions.tweet_id
+WHERE mentions.deleted_at IS NULL AND mentions.user_id <> tweets.author_id
+GROUP BY mentions.user_id, tweets.author_id, mentions.tweet_id;
@@ -0,0 +1,19 @@
+-- Follows and likes are hard deleted from now on, and each pair can only
+-- exist once. Soft deleted rows and duplicates left by concurrent requests
+-- are removed first, keeping the oldest row of each pair.
+
+DELETE FROM follow_models WHERE deleted_at IS NOT NULL;
+DELETE FROM follow_models WHERE id NOT IN (
+    SELECT min(id) FROM follow_models GROUP BY followed_by_id, following_id
+);
+DROP INDEX IF EXISTS idx_follow_models_deleted_at;
+ALTER TABLE follow_models DROP COLUMN deleted_at;
+CREATE UNIQUE INDEX idx_follow_models_pair ON follow_models (followed_by_id, following_id);
+
+DELETE FROM like_models WHERE deleted_at IS NOT NULL;
+DELETE FROM like_models WHERE id NOT IN (
+    SELECT min(id) FROM like_models GROUP BY user_id, tweet_id
+);
+DROP INDEX IF EXISTS idx_like_models_deleted_at;
+ALTER TABLE like_models DROP COLUMN deleted_at;
+CREATE UNIQUE INDEX idx_like_models_pair ON like_models (user_id, tweet_id);
@@ -0,0 +1,4 @@
+ALTER TABLE tweets DROP COLUMN likes_count;
+ALTER TABLE users DROP COLUMN tweets_count;
+ALTER TABLE users DROP COLUMN followings_count;
+ALTER TABLE users DROP COLUMN followers_count;
@@ -0,0 +1,14 @@
+-- Denormalized counters, backfilled from the rows they count. From now on
+-- the repositories keep them up to date.
+
+ALTER TABLE users ADD COLUMN followers_count bigint NOT NULL DEFAULT 0;
+ALTER TABLE users ADD COLUMN followings_count bigint NOT NULL DEFAULT 0;
+ALTER TABLE users ADD COLUMN tweets_count bigint NOT NULL DEFAULT 0;
+ALTER TABLE tweets ADD COLUMN likes_count bigint NOT NULL DEFAULT 0;
+
+UPDATE users SET
+    followers_count = (SELECT count(*) FROM follow_models WHERE follow_models.following_id = users.id),
+    followings_count = (SELECT count(*) FROM follow_models WHERE follow_models.followed_by_id = users.id),
+    tweets_count = (SELECT count(*) FROM tweets WHERE tweets.author_id = users.id AND tweets.deleted_at IS NULL);
+UPDATE tweets SET
+    likes_count = (SELECT count(*) FROM like_models WHERE like_models.tweet_id = tweets.id);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_tweets_author_id;
+DROP INDEX IF EXISTS idx_like_models_tweet_id;
+DROP INDEX IF EXISTS idx_follow_models_following_id;
@@ -0,0 +1,14 @@
+package models
+
+import "gorm.io/gorm"
+
+// Blob is a stored file addressed by the SHA-256 of its content. RefCount is
+// the number of tweets, users and media rows pointing at it.
+type Blob struct {
+	gorm.Model
+	Hash     string `gorm:"uniqueIndex;not null"`
+	Key      string `gorm:"column:storage_key;uniqueIndex;not null"`
+	Size     int64
+	MimeType string
+	RefCount int `gorm:"not null;default:0"`
+}
@@ -1,9 +1,13 @@
 package models
 
-import "gorm.io/gorm"
+import "time"
 
+// FollowModel and LikeModel are hard deleted, so they don't embed
+// gorm.Model. Each pair is unique, see the *_pair indexes.
 type FollowModel struct {
-	gorm.Model
+	ID           uint `gorm:"primarykey"`
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
 	Following    User
 	FollowingID  uint `json:"following_id"`
 	FollowedBy   User
@@ -11,9 +15,11 @@ type FollowModel struct {
 }
 
 type LikeModel struct {
-	gorm.Model
-	User    User
-	UserID  uint
-	Tweet   Tweet
-	TweetID uint
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	User      User
+	UserID    uint
+	Tweet     Tweet
+	TweetID   uint
 }
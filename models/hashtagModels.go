@@ -0,0 +1,25 @@
+package models
+
+import "gorm.io/gorm"
+
+type Hashtag struct {
+	gorm.Model
+	Name string `gorm:"column:name;uniqueIndex;not null"`
+}
+
+type TweetHashtag struct {
+	gorm.Model
+	Tweet     Tweet
+	TweetID   uint `gorm:"index"`
+	Hashtag   Hashtag
+	HashtagID uint `gorm:"index"`
+}
+
+type Trend struct {
+	gorm.Model
+	Window    string `gorm:"column:trend_window;index;not null"`
+	Hashtag   Hashtag
+	HashtagID uint
+	Count     int64
+	Score     float64
+}
@@ -0,0 +1,27 @@
+package models
+
+import "gorm.io/gorm"
+
+const (
+	MediaKindImage = "image"
+	MediaKindVideo = "video"
+)
+
+type Media struct {
+	gorm.Model
+	Owner    User  `gorm:"foreignKey:OwnerID"`
+	OwnerID  uint  `gorm:"index"`
+	TweetID  *uint `gorm:"index"`
+	Position int
+	Path     string `gorm:"not null"`
+	Kind     string `gorm:"not null"`
+	MimeType string
+	Size     int64
+	Width    int
+	Height   int
+	AltText  string
+	// DurationMs and PosterPath are only set for videos, and only when
+	// ffprobe/ffmpeg were available at upload time.
+	DurationMs int64
+	PosterPath string
+}
@@ -0,0 +1,13 @@
+package models
+
+import "gorm.io/gorm"
+
+type Mention struct {
+	gorm.Model
+	Tweet   Tweet
+	TweetID uint `gorm:"index"`
+	User    User
+	UserID  uint `gorm:"index"`
+	Start   int  `gorm:"column:start_offset"`
+	End     int  `gorm:"column:end_offset"`
+}
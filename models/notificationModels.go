@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+const NotificationMention = "mention"
+
+// Notification tells UserID that ActorID did something involving them, for
+// now mentioning them in TweetID. Each is unique per user, tweet and kind,
+// see idx_notifications_unique, so re-indexing a tweet doesn't notify twice.
+type Notification struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	User      User
+	UserID    uint `gorm:"index"`
+	Actor     User
+	ActorID   uint
+	Tweet     Tweet
+	TweetID   uint
+	Kind      string `gorm:"not null"`
+	ReadAt    *time.Time
+}
@@ -7,6 +7,13 @@ type Tweet struct {
 	Title    string `gorm:"column:title;not null"`
 	Body     string `gorm:"column:body;not null"`
 	File     string
-	AuthorID uint `json:"author_id"`
-	Author   User `gorm:"foreignKey:AuthorID"`
+	AuthorID uint    `json:"author_id"`
+	Author   User    `gorm:"foreignKey:AuthorID"`
+	Media    []Media `gorm:"foreignKey:TweetID"`
+	// LikesCount is kept up to date by the like repository.
+	LikesCount int64 `gorm:"not null;default:0"`
 }
+
+// TweetCounterColumns are only ever changed by increments, never by saving a
+// tweet.
+var TweetCounterColumns = []string{"likes_count"}
@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// UploadSession is a resumable upload in progress. The bytes received so far
+// are kept in a partial file named after ID until the upload is finalized.
+type UploadSession struct {
+	ID        string `gorm:"primaryKey;size:36"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	Owner     User `gorm:"foreignKey:OwnerID"`
+	OwnerID   uint `gorm:"index"`
+	Length    int64
+	Offset    int64 `gorm:"column:upload_offset"`
+	FileName  string
+	FileType  string
+	ExpiresAt time.Time `gorm:"index"`
+}
@@ -1,6 +1,14 @@
 package models
 
-import "gorm.io/gorm"
+import (
+	"gorm.io/gorm"
+	"time"
+)
+
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
 
 type User struct {
 	gorm.Model
@@ -9,5 +17,17 @@ type User struct {
 	Password string `gorm:"column:password;not null"`
 	Bio      string
 	Picture  string
-	Tweets   []Tweet `gorm:"foreignKey:AuthorID"`
+	Role     string `gorm:"not null;default:user"`
+	// SuspendedAt is set while an admin has suspended the account.
+	SuspendedAt *time.Time
+	Tweets      []Tweet `gorm:"foreignKey:AuthorID"`
+	// Counters are kept up to date by the repositories, see
+	// UserCounterColumns.
+	FollowersCount  int64 `gorm:"not null;default:0"`
+	FollowingsCount int64 `gorm:"not null;default:0"`
+	TweetsCount     int64 `gorm:"not null;default:0"`
 }
+
+// UserCounterColumns are only ever changed by increments, never by saving a
+// user, which could write back a stale count.
+var UserCounterColumns = []string{"followers_count", "followings_count", "tweets_count"}
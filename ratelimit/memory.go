@@ -0,0 +1,86 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// sweepInterval is how often the memory store forgets the buckets that
+// filled up again.
+const sweepInterval = time.Minute
+
+// MemoryStore keeps the buckets in memory, for a single replica.
+type MemoryStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+type bucket struct {
+	tokens   float64
+	updated  time.Time
+	capacity float64
+	rate     float64
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{buckets: make(map[string]*bucket)}
+}
+
+func (s *MemoryStore) Take(ctx context.Context, key string, policy Policy) (Result, error) {
+	return s.take(key, policy, true), nil
+}
+
+func (s *MemoryStore) Peek(ctx context.Context, key string, policy Policy) (Result, error) {
+	return s.take(key, policy, false), nil
+}
+
+func (s *MemoryStore) take(key string, policy Policy, take bool) Result {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(s.lastSweep) > sweepInterval {
+		s.sweep(now)
+	}
+
+	key = policy.Name + ":" + key
+	b, ok := s.buckets[key]
+	if !ok {
+		if !take {
+			return result(policy, true, policy.capacity())
+		}
+		b = &bucket{tokens: policy.capacity(), updated: now}
+		s.buckets[key] = b
+	}
+	b.capacity, b.rate = policy.capacity(), policy.rate()
+	b.refill(now)
+
+	allowed := b.tokens >= 1
+	if allowed && take {
+		b.tokens--
+	}
+	return result(policy, allowed, b.tokens)
+}
+
+func (b *bucket) refill(now time.Time) {
+	elapsed := now.Sub(b.updated).Seconds()
+	if elapsed > 0 {
+		b.tokens = math.Min(b.capacity, b.tokens+elapsed*b.rate)
+		b.updated = now
+	}
+}
+
+// sweep drops the buckets that are full, they are no different from new
+// ones.
+func (s *MemoryStore) sweep(now time.Time) {
+	for key, b := range s.buckets {
+		b.refill(now)
+		if b.tokens >= b.capacity {
+			delete(s.buckets, key)
+		}
+	}
+	s.lastSweep = now
+}
@@ -0,0 +1,28 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMemoryStorePeekDoesNotTake(t *testing.T) {
+	store := NewMemoryStore()
+	policy := Policy{Name: "test", Limit: 1, Period: time.Hour}
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		res, err := store.Peek(ctx, "client", policy)
+		if err != nil || !res.Allowed {
+			t.Fatalf("peek %d: got %+v, %v, want allowed", i, res, err)
+		}
+	}
+
+	if res, _ := store.Take(ctx, "client", policy); !res.Allowed {
+		t.Fatalf("take: got %+v, want allowed", res)
+	}
+	res, _ := store.Peek(ctx, "client", policy)
+	if res.Allowed || res.RetryAfter <= 0 {
+		t.Fatalf("peek after take: got %+v, want denied with a retry delay", res)
+	}
+}
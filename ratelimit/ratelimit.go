@@ -0,0 +1,74 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"time"
+)
+
+// Policy is a token bucket: it holds up to Burst tokens, refilled at Limit
+// tokens per Period, and every request takes one.
+type Policy struct {
+	// Name tells the buckets of different policies apart in a store.
+	Name   string
+	Limit  int
+	Period time.Duration
+	Burst  int
+}
+
+// rate returns the number of tokens refilled per second.
+func (p Policy) rate() float64 {
+	return float64(p.Limit) / p.Period.Seconds()
+}
+
+// capacity returns the size of the bucket, Limit if Burst isn't set.
+func (p Policy) capacity() float64 {
+	if p.Burst > 0 {
+		return float64(p.Burst)
+	}
+	return float64(p.Limit)
+}
+
+// Result is the state of a bucket after a request took from it.
+type Result struct {
+	Allowed bool
+	// Limit is the size of the bucket.
+	Limit int
+	// Remaining is the number of requests that can be made right away.
+	Remaining int
+	// RetryAfter is how long until the next request is allowed, zero if it
+	// is allowed now.
+	RetryAfter time.Duration
+	// Reset is how long until the bucket is full again.
+	Reset time.Duration
+}
+
+// Store keeps the buckets of every client. The memory store only limits
+// the requests of one replica, the Redis one shares limits between all of
+// them.
+type Store interface {
+	// Take takes a token from the bucket of key under policy, if there is
+	// one left.
+	Take(ctx context.Context, key string, policy Policy) (Result, error)
+	// Peek returns what Take would, without taking the token.
+	Peek(ctx context.Context, key string, policy Policy) (Result, error)
+}
+
+// result builds the Result of a request that left tokens in the bucket.
+func result(policy Policy, allowed bool, tokens float64) Result {
+	rate, capacity := policy.rate(), policy.capacity()
+	res := Result{
+		Allowed:   allowed,
+		Limit:     int(capacity),
+		Remaining: int(math.Floor(tokens)),
+		Reset:     seconds((capacity - tokens) / rate),
+	}
+	if !allowed {
+		res.RetryAfter = seconds((1 - tokens) / rate)
+	}
+	return res
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
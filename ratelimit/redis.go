@@ -0,0 +1,87 @@
+package ratelimit
+
+import (
+	"context"
+	"github.com/redis/go-redis/v9"
+	"strconv"
+)
+
+// takeScript refills and takes from a bucket atomically, or only looks at it
+// when ARGV[3] is 0. It reads the clock of the Redis server, so replicas with
+// skewed clocks agree, and lets the key expire once the bucket would be full
+// again.
+var takeScript = redis.NewScript(`
+local rate = tonumber(ARGV[1])
+local capacity = tonumber(ARGV[2])
+local take = ARGV[3] == '1'
+
+local time = redis.call('TIME')
+local now = tonumber(time[1]) * 1000 + math.floor(tonumber(time[2]) / 1000)
+
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'updated')
+local tokens = tonumber(state[1]) or capacity
+local updated = tonumber(state[2]) or now
+tokens = math.min(capacity, tokens + math.max(0, now - updated) * rate)
+
+local allowed = 0
+if tokens >= 1 then
+	allowed = 1
+	if take then
+		tokens = tokens - 1
+	end
+end
+
+if take then
+	redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'updated', now)
+	redis.call('PEXPIRE', KEYS[1], math.ceil((capacity - tokens) / rate) + 1000)
+end
+return {allowed, tostring(tokens)}
+`)
+
+// RedisStore keeps the buckets in Redis 5 or later, or anything speaking its
+// protocol and running Lua scripts, so every replica shares them.
+type RedisStore struct {
+	Client *redis.Client
+	// Prefix is put in front of every key.
+	Prefix string
+}
+
+func NewRedisStore(client *redis.Client) *RedisStore {
+	return &RedisStore{Client: client, Prefix: "ratelimit:"}
+}
+
+// Close closes the connections to Redis.
+func (s *RedisStore) Close() error {
+	return s.Client.Close()
+}
+
+func (s *RedisStore) Take(ctx context.Context, key string, policy Policy) (Result, error) {
+	return s.take(ctx, key, policy, true)
+}
+
+func (s *RedisStore) Peek(ctx context.Context, key string, policy Policy) (Result, error) {
+	return s.take(ctx, key, policy, false)
+}
+
+func (s *RedisStore) take(ctx context.Context, key string, policy Policy, take bool) (Result, error) {
+	// The script works in milliseconds.
+	rate := policy.rate() / 1000
+	keys := []string{s.Prefix + policy.Name + ":" + key}
+	flag := 0
+	if take {
+		flag = 1
+	}
+
+	reply, err := takeScript.Run(ctx, s.Client, keys, rate, policy.capacity(), flag).Slice()
+	if err != nil {
+		return Result{}, err
+	}
+
+	allowed, _ := reply[0].(int64)
+	raw, _ := reply[1].(string)
+	tokens, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		return Result{}, err
+	}
+	return result(policy, allowed == 1, tokens), nil
+}
@@ -0,0 +1,28 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"github.com/redis/go-redis/v9"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestRedisStoreCloses(t *testing.T) {
+	// The client only connects when it is used, so no server is needed.
+	var store Store = NewRedisStore(redis.NewClient(&redis.Options{Addr: "localhost:0"}))
+
+	closer, ok := store.(io.Closer)
+	if !ok {
+		t.Fatal("RedisStore is not an io.Closer, its connections would never be closed")
+	}
+	if err := closer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	policy := Policy{Name: "test", Limit: 1, Period: time.Hour}
+	if _, err := store.Take(context.Background(), "client", policy); !errors.Is(err, redis.ErrClosed) {
+		t.Fatalf("take after closing: got %v, want %v", err, redis.ErrClosed)
+	}
+}
@@ -0,0 +1,310 @@
+package repositories
+
+import (
+	"context"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"main/models"
+	"strings"
+)
+
+// The gorm repositories only use SQL that Postgres and SQLite both
+// understand. What differs between the two is kept in a dialect.
+type dialect struct {
+	// caseInsensitiveLike is the operator matching a LIKE pattern without
+	// regard to case.
+	caseInsensitiveLike string
+}
+
+// likePattern escapes the LIKE wildcards in s and wraps it in %, so it
+// matches s anywhere in a string. Use it with ESCAPE '\'.
+func likePattern(s string) string {
+	s = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+	return "%" + s + "%"
+}
+
+// increment adds delta to a counter column of the row of model with the
+// given ID. It bypasses hooks and leaves updated_at alone.
+func increment(tx *gorm.DB, model interface{}, id uint, column string, delta int) error {
+	return tx.Model(model).Where("id = ?", id).UpdateColumn(column, gorm.Expr(column+" + ?", delta)).Error
+}
+
+type gormUsers struct {
+	db *gorm.DB
+}
+
+func (r *gormUsers) FindByID(ctx context.Context, id uint) (models.User, error) {
+	var user models.User
+	err := r.db.WithContext(ctx).Where("id = ?", id).First(&user).Error
+	return user, notFound(err)
+}
+
+func (r *gormUsers) FindByUserName(ctx context.Context, userName string) (models.User, error) {
+	var user models.User
+	err := r.db.WithContext(ctx).Where("username = ?", userName).First(&user).Error
+	return user, notFound(err)
+}
+
+func (r *gormUsers) FindByEmail(ctx context.Context, email string) (models.User, error) {
+	var user models.User
+	err := r.db.WithContext(ctx).Where("email = ?", email).First(&user).Error
+	return user, notFound(err)
+}
+
+func (r *gormUsers) Create(ctx context.Context, user *models.User) error {
+	return r.db.WithContext(ctx).Create(user).Error
+}
+
+func (r *gormUsers) Save(ctx context.Context, user *models.User) error {
+	return r.db.WithContext(ctx).Omit(models.UserCounterColumns...).Save(user).Error
+}
+
+type gormTweets struct {
+	db      *gorm.DB
+	dialect dialect
+}
+
+func (r *gormTweets) FindByID(ctx context.Context, id uint) (models.Tweet, error) {
+	var tweet models.Tweet
+	err := r.db.WithContext(ctx).Where("id = ?", id).First(&tweet).Error
+	return tweet, notFound(err)
+}
+
+func (r *gormTweets) FindByAuthor(ctx context.Context, id, authorID uint) (models.Tweet, error) {
+	var tweet models.Tweet
+	err := r.db.WithContext(ctx).Where("id = ? AND author_id = ?", id, authorID).First(&tweet).Error
+	return tweet, notFound(err)
+}
+
+func (r *gormTweets) Search(ctx context.Context, query string) ([]models.Tweet, error) {
+	tx := r.db.WithContext(ctx).Select("id, title, body, created_at, likes_count")
+	if query != "" {
+		like := r.dialect.caseInsensitiveLike
+		pattern := likePattern(query)
+		tx = tx.Where("title "+like+" ? ESCAPE '\\' OR body "+like+" ? ESCAPE '\\'", pattern, pattern)
+	}
+
+	var tweets []models.Tweet
+	err := tx.Find(&tweets).Error
+	return tweets, err
+}
+
+func (r *gormTweets) Create(ctx context.Context, tweet *models.Tweet, media []models.Media) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(tweet).Error; err != nil {
+			return err
+		}
+		if err := increment(tx, &models.User{}, tweet.AuthorID, "tweets_count", 1); err != nil {
+			return err
+		}
+
+		for position, item := range media {
+			result := tx.Model(&models.Media{}).
+				Where("id = ? AND tweet_id IS NULL", item.ID).
+				Updates(map[string]interface{}{"tweet_id": tweet.ID, "position": position})
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return &MediaAttachedError{MediaID: item.ID}
+			}
+		}
+		return nil
+	})
+}
+
+func (r *gormTweets) Save(ctx context.Context, tweet *models.Tweet) error {
+	return r.db.WithContext(ctx).Omit(models.TweetCounterColumns...).Save(tweet).Error
+}
+
+func (r *gormTweets) Delete(ctx context.Context, tweet *models.Tweet) ([]string, error) {
+	var files []string
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Delete(tweet)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected > 0 {
+			if err := increment(tx, &models.User{}, tweet.AuthorID, "tweets_count", -1); err != nil {
+				return err
+			}
+			var err error
+			if files, err = tweetFiles(tx, tweet); err != nil {
+				return err
+			}
+		}
+		if err := tx.Where("tweet_id = ?", tweet.ID).Delete(&models.TweetHashtag{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("tweet_id = ?", tweet.ID).Delete(&models.Mention{}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+func (r *gormTweets) Purge(ctx context.Context, id uint) ([]string, error) {
+	var files []string
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var tweet models.Tweet
+		if err := tx.Unscoped().Where("id = ?", id).First(&tweet).Error; err != nil {
+			return notFound(err)
+		}
+
+		// Delete released the files of soft deleted tweets.
+		if !tweet.DeletedAt.Valid {
+			var err error
+			if files, err = tweetFiles(tx, &tweet); err != nil {
+				return err
+			}
+		}
+
+		for _, model := range []interface{}{&models.Media{}, &models.LikeModel{}, &models.TweetHashtag{}, &models.Mention{}, &models.Notification{}} {
+			if err := tx.Unscoped().Where("tweet_id = ?", id).Delete(model).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Unscoped().Delete(&tweet).Error; err != nil {
+			return err
+		}
+
+		// Soft deleted tweets were already taken off the count.
+		if !tweet.DeletedAt.Valid {
+			return increment(tx, &models.User{}, tweet.AuthorID, "tweets_count", -1)
+		}
+		return nil
+	})
+	return files, err
+}
+
+// tweetFiles returns the stored files of a tweet and of its media.
+func tweetFiles(tx *gorm.DB, tweet *models.Tweet) ([]string, error) {
+	var media []models.Media
+	if err := tx.Unscoped().Where("tweet_id = ?", tweet.ID).Find(&media).Error; err != nil {
+		return nil, err
+	}
+	files := []string{tweet.File}
+	for _, item := range media {
+		files = append(files, item.Path, item.PosterPath)
+	}
+	return files, nil
+}
+
+type gormFollows struct {
+	db *gorm.DB
+}
+
+func (r *gormFollows) Exists(ctx context.Context, followerID, followeeID uint) (bool, error) {
+	var count int64
+	err := r.db.WithContext(ctx).Model(&models.FollowModel{}).
+		Where("followed_by_id = ? AND following_id = ?", followerID, followeeID).
+		Count(&count).Error
+	return count > 0, err
+}
+
+func (r *gormFollows) Create(ctx context.Context, followerID, followeeID uint) (bool, error) {
+	follow := models.FollowModel{
+		FollowingID:  followeeID,
+		FollowedByID: followerID,
+	}
+	return r.update(ctx, 1, func(tx *gorm.DB) *gorm.DB {
+		return tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&follow)
+	}, followerID, followeeID)
+}
+
+func (r *gormFollows) Delete(ctx context.Context, followerID, followeeID uint) (bool, error) {
+	return r.update(ctx, -1, func(tx *gorm.DB) *gorm.DB {
+		return tx.Where("followed_by_id = ? AND following_id = ?", followerID, followeeID).
+			Delete(&models.FollowModel{})
+	}, followerID, followeeID)
+}
+
+// update runs write in a transaction and, if it changed a row, moves the
+// follow counters of both users by delta. It reports whether a row changed.
+func (r *gormFollows) update(ctx context.Context, delta int, write func(tx *gorm.DB) *gorm.DB, followerID, followeeID uint) (bool, error) {
+	var changed bool
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := write(tx)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		changed = true
+		if err := increment(tx, &models.User{}, followerID, "followings_count", delta); err != nil {
+			return err
+		}
+		return increment(tx, &models.User{}, followeeID, "followers_count", delta)
+	})
+	return changed, err
+}
+
+func (r *gormFollows) Followers(ctx context.Context, userID uint) ([]models.User, error) {
+	var users []models.User
+	err := r.db.WithContext(ctx).
+		Joins("JOIN follow_models ON follow_models.followed_by_id = users.id").
+		Where("follow_models.following_id = ?", userID).
+		Find(&users).Error
+	return users, err
+}
+
+func (r *gormFollows) Followings(ctx context.Context, userID uint) ([]models.User, error) {
+	var users []models.User
+	err := r.db.WithContext(ctx).
+		Joins("JOIN follow_models ON follow_models.following_id = users.id").
+		Where("follow_models.followed_by_id = ?", userID).
+		Find(&users).Error
+	return users, err
+}
+
+type gormLikes struct {
+	db *gorm.DB
+}
+
+func (r *gormLikes) Exists(ctx context.Context, userID, tweetID uint) (bool, error) {
+	var count int64
+	err := r.db.WithContext(ctx).Model(&models.LikeModel{}).
+		Where("user_id = ? AND tweet_id = ?", userID, tweetID).
+		Count(&count).Error
+	return count > 0, err
+}
+
+func (r *gormLikes) Create(ctx context.Context, userID, tweetID uint) (bool, error) {
+	like := models.LikeModel{
+		UserID:  userID,
+		TweetID: tweetID,
+	}
+	return r.update(ctx, 1, func(tx *gorm.DB) *gorm.DB {
+		return tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&like)
+	}, tweetID)
+}
+
+func (r *gormLikes) Delete(ctx context.Context, userID, tweetID uint) (bool, error) {
+	return r.update(ctx, -1, func(tx *gorm.DB) *gorm.DB {
+		return tx.Where("user_id = ? AND tweet_id = ?", userID, tweetID).
+			Delete(&models.LikeModel{})
+	}, tweetID)
+}
+
+// update runs write in a transaction and, if it changed a row, moves the like
+// counter of the tweet by delta. It reports whether a row changed.
+func (r *gormLikes) update(ctx context.Context, delta int, write func(tx *gorm.DB) *gorm.DB, tweetID uint) (bool, error) {
+	var changed bool
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := write(tx)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		changed = true
+		return increment(tx, &models.Tweet{}, tweetID, "likes_count", delta)
+	})
+	return changed, err
+}
+
+func newGorm(db *gorm.DB, d dialect) *Repositories {
+	return &Repositories{
+		Users:   &gormUsers{db: db},
+		Tweets:  &gormTweets{db: db, dialect: d},
+		Follows: &gormFollows{db: db},
+		Likes:   &gormLikes{db: db},
+	}
+}
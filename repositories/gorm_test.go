@@ -0,0 +1,143 @@
+package repositories
+
+import (
+	"context"
+	"main/models"
+	"main/testdb"
+	"sort"
+	"testing"
+)
+
+func createUsers(t *testing.T, repos *Repositories, names ...string) []models.User {
+	t.Helper()
+
+	users := make([]models.User, len(names))
+	for i, name := range names {
+		users[i] = models.User{UserName: name, Email: name + "@example.com", Password: "hash"}
+		if err := repos.Users.Create(context.Background(), &users[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return users
+}
+
+func userNames(users []models.User) []string {
+	names := make([]string, len(users))
+	for i, user := range users {
+		names[i] = user.UserName
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestFollows(t *testing.T) {
+	repos := New(testdb.Open(t))
+	ctx := context.Background()
+	users := createUsers(t, repos, "alice", "bob", "carol")
+	alice, bob, carol := users[0], users[1], users[2]
+
+	for _, follow := range [][2]models.User{{alice, bob}, {carol, bob}, {bob, alice}} {
+		created, err := repos.Follows.Create(ctx, follow[0].ID, follow[1].ID)
+		if err != nil || !created {
+			t.Fatalf("%s following %s: got %v, %v", follow[0].UserName, follow[1].UserName, created, err)
+		}
+	}
+	// Following twice is not an error, and changes nothing.
+	if created, err := repos.Follows.Create(ctx, alice.ID, bob.ID); err != nil || created {
+		t.Fatalf("following again: got %v, %v, want false, nil", created, err)
+	}
+
+	followers, err := repos.Follows.Followers(ctx, bob.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := userNames(followers); len(got) != 2 || got[0] != "alice" || got[1] != "carol" {
+		t.Fatalf("followers of bob: got %v, want [alice carol]", got)
+	}
+	followings, err := repos.Follows.Followings(ctx, alice.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := userNames(followings); len(got) != 1 || got[0] != "bob" {
+		t.Fatalf("followings of alice: got %v, want [bob]", got)
+	}
+
+	bob, err = repos.Users.FindByID(ctx, bob.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bob.FollowersCount != 2 || bob.FollowingsCount != 1 {
+		t.Fatalf("bob's counts: got %d followers and %d followings, want 2 and 1", bob.FollowersCount, bob.FollowingsCount)
+	}
+
+	if deleted, err := repos.Follows.Delete(ctx, alice.ID, bob.ID); err != nil || !deleted {
+		t.Fatalf("unfollowing: got %v, %v", deleted, err)
+	}
+	if deleted, err := repos.Follows.Delete(ctx, alice.ID, bob.ID); err != nil || deleted {
+		t.Fatalf("unfollowing again: got %v, %v, want false, nil", deleted, err)
+	}
+	if exists, err := repos.Follows.Exists(ctx, alice.ID, bob.ID); err != nil || exists {
+		t.Fatalf("follow after unfollowing: got %v, %v, want false, nil", exists, err)
+	}
+
+	followers, err = repos.Follows.Followers(ctx, bob.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := userNames(followers); len(got) != 1 || got[0] != "carol" {
+		t.Fatalf("followers of bob after unfollowing: got %v, want [carol]", got)
+	}
+	alice, err = repos.Users.FindByID(ctx, alice.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if alice.FollowingsCount != 0 || alice.FollowersCount != 1 {
+		t.Fatalf("alice's counts: got %d followers and %d followings, want 1 and 0", alice.FollowersCount, alice.FollowingsCount)
+	}
+}
+
+func TestTweetSearchEscapesWildcards(t *testing.T) {
+	repos := New(testdb.Open(t))
+	ctx := context.Background()
+	author := createUsers(t, repos, "alice")[0]
+
+	for _, body := range []string{"100% sure", "1000 sure", "snake_case", "snakeXcase", `back\slash`} {
+		tweet := models.Tweet{Title: "tweet", Body: body, AuthorID: author.ID}
+		if err := repos.Tweets.Create(ctx, &tweet, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"0%", []string{"100% sure"}},
+		{"e_c", []string{"snake_case"}},
+		{`k\s`, []string{`back\slash`}},
+		{"SNAKE", []string{"snakeXcase", "snake_case"}},
+		{"%", []string{"100% sure"}},
+		{"_", []string{"snake_case"}},
+	}
+	for _, test := range tests {
+		tweets, err := repos.Tweets.Search(ctx, test.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, tweet := range tweets {
+			got = append(got, tweet.Body)
+		}
+		sort.Strings(got)
+		if len(got) != len(test.want) {
+			t.Errorf("Search(%q): got %q, want %q", test.query, got, test.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != test.want[i] {
+				t.Errorf("Search(%q): got %q, want %q", test.query, got, test.want)
+				break
+			}
+		}
+	}
+}
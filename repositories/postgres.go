@@ -0,0 +1,8 @@
+package repositories
+
+import "gorm.io/gorm"
+
+// NewPostgres returns repositories backed by a Postgres database.
+func NewPostgres(db *gorm.DB) *Repositories {
+	return newGorm(db, dialect{caseInsensitiveLike: "ILIKE"})
+}
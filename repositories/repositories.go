@@ -0,0 +1,103 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"main/models"
+)
+
+// ErrNotFound is returned when the requested row doesn't exist.
+var ErrNotFound = errors.New("record not found")
+
+// MediaAttachedError is returned by TweetRepository.Create when one of the
+// media was attached to another tweet in the meantime.
+type MediaAttachedError struct {
+	MediaID uint
+}
+
+func (e *MediaAttachedError) Error() string {
+	return fmt.Sprintf("Media %d is already attached", e.MediaID)
+}
+
+type UserRepository interface {
+	FindByID(ctx context.Context, id uint) (models.User, error)
+	FindByUserName(ctx context.Context, userName string) (models.User, error)
+	FindByEmail(ctx context.Context, email string) (models.User, error)
+	Create(ctx context.Context, user *models.User) error
+	Save(ctx context.Context, user *models.User) error
+}
+
+type TweetRepository interface {
+	FindByID(ctx context.Context, id uint) (models.Tweet, error)
+	// FindByAuthor finds a tweet only if it was written by authorID.
+	FindByAuthor(ctx context.Context, id, authorID uint) (models.Tweet, error)
+	// Search returns the tweets whose title or body contain query, ignoring
+	// case. An empty query returns every tweet.
+	Search(ctx context.Context, query string) ([]models.Tweet, error)
+	// Create inserts the tweet and attaches the given media to it, in that
+	// order, all in one transaction along with the author's tweet count.
+	Create(ctx context.Context, tweet *models.Tweet, media []models.Media) error
+	Save(ctx context.Context, tweet *models.Tweet) error
+	// Delete removes the tweet along with its hashtag and mention rows, and
+	// decrements the author's tweet count. It returns the stored files of the
+	// tweet and its media, for the caller to release, or none if the tweet
+	// was already deleted.
+	Delete(ctx context.Context, tweet *models.Tweet) ([]string, error)
+	// Purge hard deletes a tweet, soft deleted or not, along with its media,
+	// likes, hashtags, mentions and notifications. It returns the stored files
+	// they referenced for the caller to release, or none if the tweet was
+	// soft deleted, as Delete returned them then.
+	Purge(ctx context.Context, id uint) ([]string, error)
+}
+
+// FollowRepository stores who follows whom. followerID is the user who
+// follows, followeeID the user being followed. Creating and deleting a follow
+// update the follower and following counts of both users in the same
+// transaction.
+type FollowRepository interface {
+	Exists(ctx context.Context, followerID, followeeID uint) (bool, error)
+	// Create reports whether the follow is new. Following someone twice is
+	// not an error.
+	Create(ctx context.Context, followerID, followeeID uint) (bool, error)
+	// Delete reports whether there was a follow to delete.
+	Delete(ctx context.Context, followerID, followeeID uint) (bool, error)
+	// Followers lists the users following userID.
+	Followers(ctx context.Context, userID uint) ([]models.User, error)
+	// Followings lists the users userID follows.
+	Followings(ctx context.Context, userID uint) ([]models.User, error)
+}
+
+// LikeRepository stores likes. Creating and deleting a like update the
+// tweet's like count in the same transaction.
+type LikeRepository interface {
+	Exists(ctx context.Context, userID, tweetID uint) (bool, error)
+	// Create reports whether the like is new. Liking a tweet twice is not an
+	// error.
+	Create(ctx context.Context, userID, tweetID uint) (bool, error)
+	// Delete reports whether there was a like to delete.
+	Delete(ctx context.Context, userID, tweetID uint) (bool, error)
+}
+
+type Repositories struct {
+	Users   UserRepository
+	Tweets  TweetRepository
+	Follows FollowRepository
+	Likes   LikeRepository
+}
+
+// New returns the repositories matching the database db is connected to.
+func New(db *gorm.DB) *Repositories {
+	if db.Dialector.Name() == "sqlite" {
+		return NewSQLite(db)
+	}
+	return NewPostgres(db)
+}
+
+func notFound(err error) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrNotFound
+	}
+	return err
+}
@@ -0,0 +1,10 @@
+package repositories
+
+import "gorm.io/gorm"
+
+// NewSQLite returns repositories backed by an SQLite database, for running
+// the API without a Postgres server.
+func NewSQLite(db *gorm.DB) *Repositories {
+	// LIKE ignores case in SQLite, for ASCII letters at least.
+	return newGorm(db, dialect{caseInsensitiveLike: "LIKE"})
+}
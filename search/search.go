@@ -0,0 +1,135 @@
+package search
+
+import (
+	"context"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"main/models"
+	"main/utils"
+)
+
+// Service keeps the hashtag and mention rows of tweets, which search,
+// hashtag pages and mention lists are served from, in sync with their text.
+type Service struct {
+	DB *gorm.DB
+}
+
+func New(db *gorm.DB) *Service {
+	return &Service{DB: db}
+}
+
+// Index syncs both the hashtags and the mentions of a tweet.
+func (s *Service) Index(ctx context.Context, tweet models.Tweet) error {
+	if err := s.SyncHashtags(ctx, tweet); err != nil {
+		return err
+	}
+	return s.SyncMentions(ctx, tweet)
+}
+
+// SyncHashtags replaces the hashtag rows of a tweet with the tags
+// currently found in its title and body.
+func (s *Service) SyncHashtags(ctx context.Context, tweet models.Tweet) error {
+	tags := utils.ExtractHashtags(tweet.Title, tweet.Body)
+
+	return s.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Where("tweet_id = ?", tweet.ID).Delete(&models.TweetHashtag{}).Error; err != nil {
+			return err
+		}
+
+		for _, tag := range tags {
+			hashtag := models.Hashtag{Name: tag}
+			if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&hashtag).Error; err != nil {
+				return err
+			}
+			if hashtag.ID == 0 {
+				if err := tx.Where("name = ?", tag).First(&hashtag).Error; err != nil {
+					return err
+				}
+			}
+
+			tweetHashtag := models.TweetHashtag{
+				TweetID:   tweet.ID,
+				HashtagID: hashtag.ID,
+			}
+			if err := tx.Create(&tweetHashtag).Error; err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// SyncMentions replaces the mention rows of a tweet with the @usernames
+// found in its body, and notifies the users mentioned for the first time.
+// Usernames that don't resolve to a user are skipped.
+func (s *Service) SyncMentions(ctx context.Context, tweet models.Tweet) error {
+	matches := utils.ExtractMentions(tweet.Body)
+
+	names := make([]string, 0, len(matches))
+	for _, match := range matches {
+		names = append(names, match.UserName)
+	}
+
+	return s.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Where("tweet_id = ?", tweet.ID).Delete(&models.Mention{}).Error; err != nil {
+			return err
+		}
+
+		if len(names) == 0 {
+			return nil
+		}
+
+		var users []models.User
+		if err := tx.Where("username IN ?", names).Find(&users).Error; err != nil {
+			return err
+		}
+
+		userIDs := make(map[string]uint, len(users))
+		for _, user := range users {
+			userIDs[user.UserName] = user.ID
+		}
+
+		var mentions []models.Mention
+		for _, match := range matches {
+			userID, ok := userIDs[match.UserName]
+			if !ok {
+				continue
+			}
+			mentions = append(mentions, models.Mention{
+				TweetID: tweet.ID,
+				UserID:  userID,
+				Start:   match.Start,
+				End:     match.End,
+			})
+		}
+
+		if len(mentions) == 0 {
+			return nil
+		}
+		if err := tx.Create(&mentions).Error; err != nil {
+			return err
+		}
+
+		var notifications []models.Notification
+		notified := make(map[uint]bool)
+		for _, mention := range mentions {
+			if mention.UserID == tweet.AuthorID || notified[mention.UserID] {
+				continue
+			}
+			notified[mention.UserID] = true
+			notifications = append(notifications, models.Notification{
+				UserID:  mention.UserID,
+				ActorID: tweet.AuthorID,
+				TweetID: tweet.ID,
+				Kind:    models.NotificationMention,
+			})
+		}
+		if len(notifications) == 0 {
+			return nil
+		}
+		// Users mentioned by an earlier version of the tweet were already
+		// notified.
+		return tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&notifications).Error
+	})
+}
@@ -0,0 +1,59 @@
+package search
+
+import (
+	"context"
+	"main/models"
+	"main/testdb"
+	"testing"
+)
+
+func TestSyncMentionsNotifiesOnce(t *testing.T) {
+	db := testdb.Open(t)
+	service := New(db)
+	ctx := context.Background()
+
+	var users []models.User
+	for _, name := range []string{"alice", "bob", "carol"} {
+		user := models.User{UserName: name, Email: name + "@example.com", Password: "x"}
+		if err := db.Create(&user).Error; err != nil {
+			t.Fatal(err)
+		}
+		users = append(users, user)
+	}
+	alice, bob, carol := users[0], users[1], users[2]
+
+	// Authors aren't notified of their own mentions, nor twice of the same.
+	tweet := models.Tweet{Title: "hi", Body: "@bob @bob @alice @nobody", AuthorID: alice.ID}
+	if err := db.Create(&tweet).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := service.SyncMentions(ctx, tweet); err != nil {
+		t.Fatal(err)
+	}
+
+	// Editing the tweet only notifies the users it newly mentions.
+	tweet.Body = "@bob @carol"
+	if err := service.SyncMentions(ctx, tweet); err != nil {
+		t.Fatal(err)
+	}
+
+	var notifications []models.Notification
+	if err := db.Order("user_id").Find(&notifications).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(notifications) != 2 {
+		t.Fatalf("got %d notifications, want 2", len(notifications))
+	}
+	for i, want := range []models.User{bob, carol} {
+		n := notifications[i]
+		if n.UserID != want.ID || n.ActorID != alice.ID || n.TweetID != tweet.ID || n.Kind != models.NotificationMention {
+			t.Errorf("notification %d: got %+v, want a mention of %s by alice", i, n, want.UserName)
+		}
+	}
+
+	var mentions int64
+	db.Model(&models.Mention{}).Where("tweet_id = ?", tweet.ID).Count(&mentions)
+	if mentions != 2 {
+		t.Fatalf("got %d mention rows, want 2", mentions)
+	}
+}
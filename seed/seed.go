@@ -0,0 +1,529 @@
+package seed
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"image"
+	"image/color"
+	"image/png"
+	"main/blobs"
+	"main/models"
+	"main/utils"
+	"math/rand"
+	"strings"
+	"time"
+)
+
+// batchSize keeps every insert well below the bind parameter limits of
+// Postgres and SQLite.
+const batchSize = 500
+
+// ErrNotEmpty is returned when the database already has users, as seeded
+// usernames would clash with them.
+var ErrNotEmpty = errors.New("database already has users, seed an empty database")
+
+type Options struct {
+	// Seed makes the generated data reproducible: the same seed and options
+	// always give the same users, follows, tweets and likes. Timestamps are
+	// relative to the time of seeding.
+	Seed  int64
+	Users int
+	// Follows, TweetsPerUser and LikesPerTweet are averages. Individual
+	// counts are heavy tailed, a few users get most of the followers.
+	Follows       int
+	TweetsPerUser int
+	LikesPerTweet int
+	// ImageRatio is the share of tweets with a placeholder image.
+	ImageRatio float64
+	// Password is the password of every user. It is hashed once, so
+	// seeding doesn't spend minutes in bcrypt.
+	Password string
+	// Days is how far back in time the data is spread.
+	Days int
+}
+
+type Report struct {
+	Users    int
+	Follows  int
+	Tweets   int
+	Likes    int
+	Hashtags int
+	Mentions int
+	Images   int
+}
+
+// generator holds the state of one seeding run. Everything random is drawn
+// from rng, in a fixed order, so runs are reproducible.
+type generator struct {
+	rng   *rand.Rand
+	opts  Options
+	start time.Time
+	now   time.Time
+
+	zipfs map[int]*rand.Zipf
+
+	users    []models.User
+	follows  []models.FollowModel
+	tweets   []models.Tweet
+	likes    []models.LikeModel
+	mentions []models.Mention
+	// tweetTags and tweetImages hold the hashtags and the placeholder image
+	// (-1 for none) of each tweet, by index in tweets.
+	tweetTags   [][]string
+	tweetImages []int
+}
+
+// Run fills an empty database with generated users, a follower graph,
+// tweets with hashtags, mentions and images, and likes.
+func Run(ctx context.Context, db *gorm.DB, store *blobs.Service, opts Options) (*Report, error) {
+	var count int64
+	if err := db.WithContext(ctx).Model(&models.User{}).Count(&count).Error; err != nil {
+		return nil, err
+	}
+	if count > 0 {
+		return nil, ErrNotEmpty
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(opts.Password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	g := &generator{
+		rng:   rand.New(rand.NewSource(opts.Seed)),
+		zipfs: make(map[int]*rand.Zipf),
+		opts:  opts,
+		start: now.AddDate(0, 0, -opts.Days),
+		now:   now,
+	}
+	g.generateUsers(string(hash))
+	g.generateFollows()
+	g.generateTweets()
+	g.generateLikes()
+
+	// Images are stored before the transaction: blobs take their references
+	// through their own connection, which SQLite only has one of.
+	images, err := g.storeImages(ctx, store)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &Report{Images: images}
+	err = db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return g.insert(tx, report)
+	})
+	if err != nil {
+		for _, tweet := range g.tweets {
+			_ = store.Release(ctx, tweet.File)
+		}
+		return nil, err
+	}
+	return report, nil
+}
+
+var firstNames = []string{
+	"ada", "alan", "barbara", "brian", "claude", "dennis", "donald", "edsger",
+	"frances", "grace", "guido", "hedy", "ivan", "james", "john", "ken",
+	"linus", "margaret", "niklaus", "radia", "rob", "shafi", "sophie", "tim",
+}
+
+var topics = []string{
+	"golang", "postgres", "sqlite", "docker", "kubernetes", "rust", "linux",
+	"opensource", "devops", "testing", "security", "performance", "webdev",
+	"databases", "cloud", "career", "coffee", "music", "travel", "books",
+}
+
+var words = strings.Fields(`just shipped a new build of the service today and the
+latency looks much better than last week while the team keeps arguing about
+naming things caching invalidation and whether tabs beat spaces anyway the
+migration ran fine on staging so production is next after lunch`)
+
+var bios = []string{
+	"", "Backend developer.", "Writes Go for a living.", "Coffee first.",
+	"Databases, distributed systems and bad puns.", "Views are my own.",
+	"Building things on the internet.", "Open source maintainer.",
+}
+
+// pick returns an index below n, favouring low indexes with a power law.
+// Used with a popularity ranking, it gives a few items most of the picks.
+func (g *generator) pick(n int) int {
+	if n <= 1 {
+		return 0
+	}
+	zipf, ok := g.zipfs[n]
+	if !ok {
+		zipf = rand.NewZipf(g.rng, 1.2, 1, uint64(n-1))
+		g.zipfs[n] = zipf
+	}
+	return int(zipf.Uint64())
+}
+
+// heavyTail returns a non-negative count averaging mean, with an
+// exponential tail.
+func (g *generator) heavyTail(mean int) int {
+	return int(g.rng.ExpFloat64() * float64(mean))
+}
+
+// between returns a random time between from and to.
+func (g *generator) between(from, to time.Time) time.Time {
+	span := to.Sub(from)
+	if span <= 0 {
+		return from
+	}
+	return from.Add(time.Duration(g.rng.Int63n(int64(span))))
+}
+
+func (g *generator) generateUsers(hash string) {
+	// Users join during the first half of the period, so they all have
+	// time to tweet.
+	joinedBy := g.start.Add(g.now.Sub(g.start) / 2)
+
+	g.users = make([]models.User, g.opts.Users)
+	for i := range g.users {
+		name := fmt.Sprintf("%s_%d", firstNames[i%len(firstNames)], i+1)
+		createdAt := g.between(g.start, joinedBy)
+		g.users[i] = models.User{
+			UserName: name,
+			Email:    name + "@example.com",
+			Password: hash,
+			Bio:      bios[g.rng.Intn(len(bios))],
+			Role:     models.RoleUser,
+		}
+		g.users[i].CreatedAt = createdAt
+		g.users[i].UpdatedAt = createdAt
+	}
+}
+
+// generateFollows builds a follower graph where a user's chance to be
+// followed falls with their rank in a shuffled popularity order.
+func (g *generator) generateFollows() {
+	n := len(g.users)
+	ranking := g.rng.Perm(n)
+
+	for follower := range g.users {
+		want := g.heavyTail(g.opts.Follows)
+		if want > n-1 {
+			want = n - 1
+		}
+
+		followed := make(map[int]bool, want)
+		for attempts := 0; len(followed) < want && attempts < want*10; attempts++ {
+			followee := ranking[g.pick(n)]
+			if followee == follower || followed[followee] {
+				continue
+			}
+			followed[followee] = true
+
+			createdAt := g.between(later(g.users[follower].CreatedAt, g.users[followee].CreatedAt), g.now)
+			g.follows = append(g.follows, models.FollowModel{
+				CreatedAt:    createdAt,
+				UpdatedAt:    createdAt,
+				FollowedByID: uint(follower),
+				FollowingID:  uint(followee),
+			})
+			g.users[follower].FollowingsCount++
+			g.users[followee].FollowersCount++
+		}
+	}
+}
+
+func (g *generator) generateTweets() {
+	for author := range g.users {
+		count := g.heavyTail(g.opts.TweetsPerUser)
+		for i := 0; i < count; i++ {
+			title, body, tags := g.text()
+			createdAt := g.between(g.users[author].CreatedAt, g.now)
+
+			tweet := models.Tweet{
+				Title:    title,
+				Body:     body,
+				AuthorID: uint(author),
+			}
+			tweet.CreatedAt = createdAt
+			tweet.UpdatedAt = createdAt
+
+			picture := -1
+			if g.rng.Float64() < g.opts.ImageRatio {
+				picture = g.rng.Intn(len(placeholderColors))
+			}
+
+			g.tweets = append(g.tweets, tweet)
+			g.tweetTags = append(g.tweetTags, tags)
+			g.tweetImages = append(g.tweetImages, picture)
+			g.users[author].TweetsCount++
+		}
+	}
+}
+
+// text returns the title and body of a tweet and the hashtags in them. Some
+// bodies mention another user.
+func (g *generator) text() (string, string, []string) {
+	sentence := func(min, max int) string {
+		n := min + g.rng.Intn(max-min+1)
+		start := g.rng.Intn(len(words))
+		parts := make([]string, n)
+		for i := range parts {
+			parts[i] = words[(start+i)%len(words)]
+		}
+		return strings.Join(parts, " ")
+	}
+
+	title := sentence(2, 5)
+	body := sentence(6, 20)
+
+	for i := g.rng.Intn(3); i > 0; i-- {
+		body += " #" + topics[g.pick(len(topics))]
+	}
+	if len(g.users) > 1 && g.rng.Float64() < 0.2 {
+		body = "@" + g.users[g.rng.Intn(len(g.users))].UserName + " " + body
+	}
+
+	return title, body, utils.ExtractHashtags(title, body)
+}
+
+// generateLikes likes tweets by random users, more of them for tweets of
+// popular authors.
+func (g *generator) generateLikes() {
+	n := len(g.users)
+	for i := range g.tweets {
+		author := g.users[g.tweets[i].AuthorID]
+		mean := g.opts.LikesPerTweet
+		if author.FollowersCount > int64(mean) {
+			mean = (mean + int(author.FollowersCount)) / 2
+		}
+		want := g.heavyTail(mean)
+		if want > n {
+			want = n
+		}
+
+		liked := make(map[int]bool, want)
+		for attempts := 0; len(liked) < want && attempts < want*10; attempts++ {
+			user := g.rng.Intn(n)
+			if liked[user] {
+				continue
+			}
+			liked[user] = true
+
+			createdAt := g.between(g.tweets[i].CreatedAt, g.now)
+			g.likes = append(g.likes, models.LikeModel{
+				CreatedAt: createdAt,
+				UpdatedAt: createdAt,
+				UserID:    uint(user),
+				TweetID:   uint(i),
+			})
+			g.tweets[i].LikesCount++
+		}
+	}
+}
+
+var placeholderColors = []color.RGBA{
+	{0x1d, 0x9b, 0xf0, 0xff}, {0xf9, 0x18, 0x80, 0xff}, {0x79, 0x56, 0xff, 0xff},
+	{0xff, 0x7a, 0x00, 0xff}, {0x00, 0xba, 0x7c, 0xff}, {0xff, 0xd4, 0x00, 0xff},
+}
+
+// placeholder draws a gradient of c, standing in for an uploaded photo.
+func placeholder(c color.RGBA) ([]byte, error) {
+	const width, height = 640, 360
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			shade := uint8(255 * (x + y) / (width + height))
+			img.Set(x, y, color.RGBA{
+				R: uint8((int(c.R) + int(shade)) / 2),
+				G: uint8((int(c.G) + int(shade)) / 2),
+				B: uint8((int(c.B) + int(shade)) / 2),
+				A: 0xff,
+			})
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// storeImages stores the placeholder image of every tweet that has one,
+// taking a reference per tweet, and sets File to its storage key.
+func (g *generator) storeImages(ctx context.Context, store *blobs.Service) (int, error) {
+	images := make(map[int][]byte)
+	stored := 0
+	for i, index := range g.tweetImages {
+		if index < 0 {
+			continue
+		}
+
+		data, ok := images[index]
+		if !ok {
+			var err error
+			if data, err = placeholder(placeholderColors[index]); err != nil {
+				return stored, err
+			}
+			images[index] = data
+		}
+
+		key, err := store.Store(ctx, bytes.NewReader(data), ".png", "image/png")
+		if err != nil {
+			for _, tweet := range g.tweets[:i] {
+				_ = store.Release(ctx, tweet.File)
+			}
+			return stored, err
+		}
+		g.tweets[i].File = key
+		stored++
+	}
+	return stored, nil
+}
+
+// insert writes everything generated. Users, follows, tweets and likes
+// refer to each other by index until the users and tweets are inserted and
+// have their IDs.
+func (g *generator) insert(tx *gorm.DB, report *Report) error {
+	// A new session, so the Omit sticks while tx is reused for every insert.
+	tx = tx.Omit(clause.Associations).Session(&gorm.Session{})
+
+	if err := tx.CreateInBatches(&g.users, batchSize).Error; err != nil {
+		return err
+	}
+	report.Users = len(g.users)
+
+	for i := range g.follows {
+		g.follows[i].FollowedByID = g.users[g.follows[i].FollowedByID].ID
+		g.follows[i].FollowingID = g.users[g.follows[i].FollowingID].ID
+	}
+	if len(g.follows) > 0 {
+		if err := tx.CreateInBatches(&g.follows, batchSize).Error; err != nil {
+			return err
+		}
+	}
+	report.Follows = len(g.follows)
+
+	for i := range g.tweets {
+		g.tweets[i].AuthorID = g.users[g.tweets[i].AuthorID].ID
+	}
+	if len(g.tweets) > 0 {
+		if err := tx.CreateInBatches(&g.tweets, batchSize).Error; err != nil {
+			return err
+		}
+	}
+	report.Tweets = len(g.tweets)
+
+	for i := range g.likes {
+		g.likes[i].UserID = g.users[g.likes[i].UserID].ID
+		g.likes[i].TweetID = g.tweets[g.likes[i].TweetID].ID
+	}
+	if len(g.likes) > 0 {
+		if err := tx.CreateInBatches(&g.likes, batchSize).Error; err != nil {
+			return err
+		}
+	}
+	report.Likes = len(g.likes)
+
+	hashtags, err := g.insertHashtags(tx)
+	if err != nil {
+		return err
+	}
+	report.Hashtags = hashtags
+
+	mentions, err := g.insertMentions(tx)
+	if err != nil {
+		return err
+	}
+	report.Mentions = mentions
+	return nil
+}
+
+func (g *generator) insertHashtags(tx *gorm.DB) (int, error) {
+	var names []string
+	seen := make(map[string]bool)
+	for _, tags := range g.tweetTags {
+		for _, tag := range tags {
+			if !seen[tag] {
+				seen[tag] = true
+				names = append(names, tag)
+			}
+		}
+	}
+	if len(names) == 0 {
+		return 0, nil
+	}
+
+	hashtags := make([]models.Hashtag, len(names))
+	for i, name := range names {
+		hashtags[i] = models.Hashtag{Name: name}
+	}
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(&hashtags, batchSize).Error; err != nil {
+		return 0, err
+	}
+
+	// Hashtags that already existed get no ID back from the insert.
+	var existing []models.Hashtag
+	if err := tx.Where("name IN ?", names).Find(&existing).Error; err != nil {
+		return 0, err
+	}
+	ids := make(map[string]uint, len(existing))
+	for _, hashtag := range existing {
+		ids[hashtag.Name] = hashtag.ID
+	}
+
+	var links []models.TweetHashtag
+	for i, tags := range g.tweetTags {
+		for _, tag := range tags {
+			link := models.TweetHashtag{TweetID: g.tweets[i].ID, HashtagID: ids[tag]}
+			link.CreatedAt = g.tweets[i].CreatedAt
+			link.UpdatedAt = g.tweets[i].CreatedAt
+			links = append(links, link)
+		}
+	}
+	if len(links) > 0 {
+		if err := tx.CreateInBatches(&links, batchSize).Error; err != nil {
+			return 0, err
+		}
+	}
+	return len(names), nil
+}
+
+func (g *generator) insertMentions(tx *gorm.DB) (int, error) {
+	ids := make(map[string]uint, len(g.users))
+	for _, user := range g.users {
+		ids[user.UserName] = user.ID
+	}
+
+	for _, tweet := range g.tweets {
+		for _, match := range utils.ExtractMentions(tweet.Body) {
+			userID, ok := ids[match.UserName]
+			if !ok {
+				continue
+			}
+			mention := models.Mention{
+				TweetID: tweet.ID,
+				UserID:  userID,
+				Start:   match.Start,
+				End:     match.End,
+			}
+			mention.CreatedAt = tweet.CreatedAt
+			mention.UpdatedAt = tweet.CreatedAt
+			g.mentions = append(g.mentions, mention)
+		}
+	}
+	if len(g.mentions) > 0 {
+		if err := tx.CreateInBatches(&g.mentions, batchSize).Error; err != nil {
+			return 0, err
+		}
+	}
+	return len(g.mentions), nil
+}
+
+func later(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,142 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"io"
+	"net/http"
+	"time"
+)
+
+// S3Storage keeps files in a bucket of an S3-compatible service such as AWS
+// S3 or MinIO.
+type S3Storage struct {
+	client *minio.Client
+	bucket string
+}
+
+type S3Options struct {
+	Endpoint  string
+	AccessKey string
+	SecretKey string
+	Bucket    string
+	Region    string
+	UseSSL    bool
+}
+
+func NewS3Storage(ctx context.Context, opts S3Options) (*S3Storage, error) {
+	client, err := minio.New(opts.Endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(opts.AccessKey, opts.SecretKey, ""),
+		Secure: opts.UseSSL,
+		Region: opts.Region,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	exists, err := client.BucketExists(ctx, opts.Bucket)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		if err := client.MakeBucket(ctx, opts.Bucket, minio.MakeBucketOptions{Region: opts.Region}); err != nil {
+			return nil, err
+		}
+	}
+
+	return &S3Storage{client: client, bucket: opts.Bucket}, nil
+}
+
+func (s *S3Storage) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	if err := ValidateKey(key); err != nil {
+		return err
+	}
+	_, err := s.client.PutObject(ctx, s.bucket, key, r, size, minio.PutObjectOptions{ContentType: contentType})
+	return err
+}
+
+func (s *S3Storage) Get(ctx context.Context, key string) (io.ReadSeekCloser, *ObjectInfo, error) {
+	object, err := s.client.GetObject(ctx, s.bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, nil, convertS3Error(err)
+	}
+
+	info, err := object.Stat()
+	if err != nil {
+		object.Close()
+		return nil, nil, convertS3Error(err)
+	}
+
+	return object, s3ObjectInfo(info), nil
+}
+
+func (s *S3Storage) Delete(ctx context.Context, key string) error {
+	return convertS3Error(s.client.RemoveObject(ctx, s.bucket, key, minio.RemoveObjectOptions{}))
+}
+
+func (s *S3Storage) Stat(ctx context.Context, key string) (*ObjectInfo, error) {
+	info, err := s.client.StatObject(ctx, s.bucket, key, minio.StatObjectOptions{})
+	if err != nil {
+		return nil, convertS3Error(err)
+	}
+	return s3ObjectInfo(info), nil
+}
+
+func (s *S3Storage) SignedURL(ctx context.Context, key string, expiry time.Duration) (string, error) {
+	url, err := s.client.PresignedGetObject(ctx, s.bucket, key, expiry, nil)
+	if err != nil {
+		return "", convertS3Error(err)
+	}
+	return url.String(), nil
+}
+
+func (s *S3Storage) Walk(ctx context.Context, fn func(info ObjectInfo) error) error {
+	// Cancelling stops the listing goroutine if fn returns early.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	for object := range s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{Recursive: true}) {
+		if object.Err != nil {
+			return convertS3Error(object.Err)
+		}
+		if err := fn(*s3ObjectInfo(object)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Ping checks that the bucket can be reached.
+func (s *S3Storage) Ping(ctx context.Context) error {
+	exists, err := s.client.BucketExists(ctx, s.bucket)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("bucket %s does not exist", s.bucket)
+	}
+	return nil
+}
+
+func s3ObjectInfo(info minio.ObjectInfo) *ObjectInfo {
+	return &ObjectInfo{
+		Key:         info.Key,
+		Size:        info.Size,
+		ContentType: info.ContentType,
+		ModTime:     info.LastModified,
+	}
+}
+
+func convertS3Error(err error) error {
+	if err == nil {
+		return nil
+	}
+	var response minio.ErrorResponse
+	if errors.As(err, &response) && (response.StatusCode == http.StatusNotFound || response.Code == "NoSuchKey") {
+		return ErrNotFound
+	}
+	return err
+}
@@ -0,0 +1,114 @@
+package storage
+
+import (
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func signedQuery(t *testing.T, signed string) url.Values {
+	t.Helper()
+	parsed, err := url.Parse(signed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return parsed.Query()
+}
+
+func TestSignAndVerify(t *testing.T) {
+	signer := NewURLSigner("secret", "http://localhost/uploads/")
+	key := "ab/cdef0123.jpg"
+
+	hour := time.Now().Truncate(time.Hour)
+	signed, err := signer.Sign(key, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := signer.Sign(key, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The same file keeps the same URL, so browsers can cache it, unless
+	// the hour changed in between.
+	if again != signed && time.Now().Truncate(time.Hour).Equal(hour) {
+		t.Fatalf("signing twice gave %s and %s", signed, again)
+	}
+	if !strings.HasPrefix(signed, "http://localhost/uploads/"+key+"?") {
+		t.Fatalf("got URL %s", signed)
+	}
+	query := signedQuery(t, signed)
+
+	expiresAt, err := signer.Verify(key, query.Get("expires"), query.Get("signature"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if until := time.Until(expiresAt); until < 59*time.Minute || until > 2*time.Hour {
+		t.Fatalf("URL expires in %s, want between 1 and 2 hours", until)
+	}
+	if expiresAt.Unix()%3600 != 0 {
+		t.Fatalf("URL expires at %s, want a round hour so it stays the same for a while", expiresAt)
+	}
+
+	tests := []struct {
+		name                    string
+		key, expires, signature string
+	}{
+		{"other key", "ab/other.jpg", query.Get("expires"), query.Get("signature")},
+		{"other expiry", key, query.Get("expires") + "0", query.Get("signature")},
+		{"other secret", key, query.Get("expires"), NewURLSigner("other", "").signature(key, query.Get("expires"))},
+		{"no signature", key, query.Get("expires"), ""},
+	}
+	for _, test := range tests {
+		if _, err := signer.Verify(test.key, test.expires, test.signature); !errors.Is(err, ErrInvalidSignature) {
+			t.Errorf("%s: got %v, want ErrInvalidSignature", test.name, err)
+		}
+	}
+}
+
+func TestVerifyRejectsExpiredURLs(t *testing.T) {
+	signer := NewURLSigner("secret", "")
+	key := "ab/cdef0123.jpg"
+	expires := strconv.FormatInt(time.Now().Add(-time.Second).Unix(), 10)
+
+	if _, err := signer.Verify(key, expires, signer.signature(key, expires)); !errors.Is(err, ErrURLExpired) {
+		t.Fatalf("got %v, want ErrURLExpired", err)
+	}
+}
+
+func TestValidateKey(t *testing.T) {
+	valid := []string{"a", "ab/cdef0123.jpg", "ab/cdef0123_small.webp", "a-b/c_d.e"}
+	for _, key := range valid {
+		if err := ValidateKey(key); err != nil {
+			t.Errorf("ValidateKey(%q) = %v, want nil", key, err)
+		}
+	}
+
+	invalid := []string{
+		"",
+		"../etc/passwd",
+		"ab/../../secret",
+		"ab/./c.jpg",
+		"/abs/path.jpg",
+		"ab//c.jpg",
+		"ab/",
+		"ab/.hidden",
+		`ab\..\c.jpg`,
+		"ab/c.jpg?x=1",
+		"ab/c%2e%2e.jpg",
+		"ab/ç.jpg",
+		strings.Repeat("a", 513),
+	}
+	for _, key := range invalid {
+		if err := ValidateKey(key); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("ValidateKey(%q) = %v, want ErrInvalidKey", key, err)
+		}
+	}
+
+	signer := NewURLSigner("secret", "")
+	if _, err := signer.Sign("../secret", time.Hour); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("signing a traversal: got %v, want ErrInvalidKey", err)
+	}
+}
@@ -0,0 +1,34 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+)
+
+var (
+	ErrNotFound   = errors.New("object not found")
+	ErrInvalidKey = errors.New("invalid storage key")
+)
+
+type ObjectInfo struct {
+	Key         string
+	Size        int64
+	ContentType string
+	ModTime     time.Time
+}
+
+// Storage is a blob store for uploaded files. Keys are slash separated paths
+// relative to the root of the store, e.g. "tweets/20240101120000.jpg".
+type Storage interface {
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	Get(ctx context.Context, key string) (io.ReadSeekCloser, *ObjectInfo, error)
+	Delete(ctx context.Context, key string) error
+	Stat(ctx context.Context, key string) (*ObjectInfo, error)
+	SignedURL(ctx context.Context, key string, expiry time.Duration) (string, error)
+	// Walk calls fn for every stored object.
+	Walk(ctx context.Context, fn func(info ObjectInfo) error) error
+	// Ping checks that the backend is reachable and files can be stored.
+	Ping(ctx context.Context) error
+}
@@ -0,0 +1,49 @@
+// Package testdb opens throwaway databases for tests.
+package testdb
+
+import (
+	"context"
+	"gorm.io/gorm"
+	"main/config"
+	"main/initializers"
+	"main/migrations"
+	"testing"
+)
+
+// Config returns the default configuration pointed at an in-memory SQLite
+// database. It lives as long as the single connection to it, which is kept
+// open for the whole test.
+func Config() *config.Config {
+	cfg := config.Default()
+	cfg.DB.Driver = "sqlite"
+	cfg.DB.Path = ":memory:"
+	cfg.DB.MaxIdleConns = 1
+	cfg.DB.ConnMaxLifetime = 0
+	cfg.DB.ConnMaxIdleTime = 0
+	return cfg
+}
+
+// Open returns a fully migrated in-memory SQLite database, closed when t
+// ends.
+func Open(t testing.TB) *gorm.DB {
+	t.Helper()
+
+	db, err := initializers.ConnectToDB(Config())
+	if err != nil {
+		t.Fatalf("connecting to the database: %v", err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+
+	migrator, err := migrations.New(db)
+	if err != nil {
+		t.Fatalf("loading migrations: %v", err)
+	}
+	if _, err := migrator.Up(context.Background(), 0); err != nil {
+		t.Fatalf("migrating the database: %v", err)
+	}
+	return db
+}
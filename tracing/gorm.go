@@ -0,0 +1,71 @@
+package tracing
+
+import (
+	"errors"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+)
+
+const spanKey = "tracing:span"
+
+// GormPlugin runs every query of gorm in a span of its own, a child of the
+// span in the context the query was run with.
+type GormPlugin struct{}
+
+func (GormPlugin) Name() string {
+	return "tracing"
+}
+
+func (GormPlugin) Initialize(db *gorm.DB) error {
+	callbacks := db.Callback()
+	return errors.Join(
+		callbacks.Create().Before("*").Register("tracing:before_create", before("create")),
+		callbacks.Create().After("*").Register("tracing:after_create", after),
+		callbacks.Query().Before("*").Register("tracing:before_query", before("query")),
+		callbacks.Query().After("*").Register("tracing:after_query", after),
+		callbacks.Update().Before("*").Register("tracing:before_update", before("update")),
+		callbacks.Update().After("*").Register("tracing:after_update", after),
+		callbacks.Delete().Before("*").Register("tracing:before_delete", before("delete")),
+		callbacks.Delete().After("*").Register("tracing:after_delete", after),
+		callbacks.Row().Before("*").Register("tracing:before_row", before("row")),
+		callbacks.Row().After("*").Register("tracing:after_row", after),
+		callbacks.Raw().Before("*").Register("tracing:before_raw", before("raw")),
+		callbacks.Raw().After("*").Register("tracing:after_raw", after),
+	)
+}
+
+func before(operation string) func(db *gorm.DB) {
+	return func(db *gorm.DB) {
+		ctx := db.Statement.Context
+		if !trace.SpanFromContext(ctx).SpanContext().IsValid() {
+			// Background queries outside of any trace would each make a
+			// trace of their own.
+			return
+		}
+
+		_, span := Start(ctx, "gorm."+operation, attribute.String("db.system", db.Dialector.Name()))
+		db.InstanceSet(spanKey, span)
+	}
+}
+
+func after(db *gorm.DB) {
+	value, ok := db.InstanceGet(spanKey)
+	if !ok {
+		return
+	}
+	span := value.(trace.Span)
+
+	// The parameters are left out of the statement, they hold password
+	// hashes and tokens.
+	span.SetAttributes(
+		attribute.String("db.statement", db.Statement.SQL.String()),
+		attribute.String("db.sql.table", db.Statement.Table),
+		attribute.Int64("db.rows_affected", db.RowsAffected),
+	)
+	err := db.Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		err = nil
+	}
+	End(span, err)
+}
@@ -0,0 +1,35 @@
+package tracing
+
+import (
+	"context"
+	"go.opentelemetry.io/otel/attribute"
+	"io"
+	"main/storage"
+)
+
+// Storage wraps store so that writes to it are traced.
+func Storage(store storage.Storage) storage.Storage {
+	return tracedStorage{store}
+}
+
+type tracedStorage struct {
+	storage.Storage
+}
+
+func (s tracedStorage) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	ctx, span := Start(ctx, "storage.Put",
+		attribute.String("storage.key", key),
+		attribute.Int64("storage.size", size),
+		attribute.String("storage.content_type", contentType),
+	)
+	err := s.Storage.Put(ctx, key, r, size, contentType)
+	End(span, err)
+	return err
+}
+
+func (s tracedStorage) Delete(ctx context.Context, key string) error {
+	ctx, span := Start(ctx, "storage.Delete", attribute.String("storage.key", key))
+	err := s.Storage.Delete(ctx, key)
+	End(span, err)
+	return err
+}
@@ -1,19 +1,9 @@
 package utils
 
-import (
-	"os"
-	"path/filepath"
-	"strconv"
-)
+import "strings"
 
-func GetUniqueFileName(dir, baseName, ext string) string {
-	filePath := filepath.Join(dir, baseName+ext)
-	counter := 1
-	for {
-		if _, err := os.Stat(filePath); os.IsNotExist(err) {
-			return filePath
-		}
-		filePath = filepath.Join(dir, baseName+strconv.Itoa(counter)+ext)
-		counter++
-	}
+// StorageKey turns a stored file reference into a storage key. Files saved
+// before the storage backend existed were recorded with an "uploads/" prefix.
+func StorageKey(value string) string {
+	return strings.TrimPrefix(value, "uploads/")
 }
@@ -14,8 +14,11 @@ type LoginInput struct {
 }
 
 type UserResponse struct {
-	UserName string `json:"username"`
-	Email    string `json:"email"`
+	UserName        string `json:"username"`
+	Email           string `json:"email"`
+	FollowersCount  int64  `json:"followers_count"`
+	FollowingsCount int64  `json:"followings_count"`
+	TweetsCount     int64  `json:"tweets_count"`
 }
 
 type TweetCreate struct {
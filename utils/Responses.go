@@ -6,10 +6,23 @@ type TokenResponse struct {
 }
 
 type UserInfoResponse struct {
-	UserName string `json:"username"`
-	Email    string `json:"email"`
-	Bio      string `json:"bio"`
-	Picture  string `json:"picture"`
+	UserName        string            `json:"username"`
+	Email           string            `json:"email"`
+	Bio             string            `json:"bio"`
+	Picture         string            `json:"picture"`
+	PictureVariants map[string]string `json:"picture_variants"`
+}
+
+// PublicUserResponse is a user as other users see it.
+type PublicUserResponse struct {
+	ID              uint              `json:"id"`
+	UserName        string            `json:"username"`
+	Bio             string            `json:"bio"`
+	Picture         string            `json:"picture"`
+	PictureVariants map[string]string `json:"picture_variants"`
+	FollowersCount  int64             `json:"followers_count"`
+	FollowingsCount int64             `json:"followings_count"`
+	TweetsCount     int64             `json:"tweets_count"`
 }
 
 type ChangePasswordInput struct {
@@ -18,11 +31,78 @@ type ChangePasswordInput struct {
 }
 
 type TweetResponse struct {
-	ID        uint   `json:"id"`
-	CreatedAt string `json:"created_at"`
-	UpdatedAt string `json:"updated_at"`
-	Title     string `json:"title"`
-	Body      string `json:"body"`
-	File      string `json:"file"`
-	LikeCount int64
+	ID           uint              `json:"id"`
+	CreatedAt    string            `json:"created_at"`
+	UpdatedAt    string            `json:"updated_at"`
+	Title        string            `json:"title"`
+	Body         string            `json:"body"`
+	File         string            `json:"file"`
+	FileVariants map[string]string `json:"file_variants"`
+	LikesCount   int64             `json:"likes_count"`
+	Mentions     []MentionEntity   `json:"mentions"`
+	Media        []MediaResponse   `json:"media"`
+	Video        *VideoResponse    `json:"video,omitempty"`
+}
+
+type TrendResponse struct {
+	Hashtag string  `json:"hashtag"`
+	Count   int64   `json:"count"`
+	Score   float64 `json:"score"`
+}
+
+type MentionEntity struct {
+	UserID   uint   `json:"user_id"`
+	UserName string `json:"username"`
+	Start    int    `json:"start"`
+	End      int    `json:"end"`
+}
+
+type NotificationResponse struct {
+	ID            uint   `json:"id"`
+	Kind          string `json:"kind"`
+	ActorID       uint   `json:"actor_id"`
+	ActorUserName string `json:"actor_username"`
+	TweetID       uint   `json:"tweet_id"`
+	CreatedAt     string `json:"created_at"`
+	Read          bool   `json:"read"`
+}
+
+type MediaResponse struct {
+	ID             uint              `json:"id"`
+	Kind           string            `json:"kind"`
+	File           string            `json:"file"`
+	MimeType       string            `json:"mime_type"`
+	Size           int64             `json:"size"`
+	Width          int               `json:"width"`
+	Height         int               `json:"height"`
+	AltText        string            `json:"alt_text"`
+	Variants       map[string]string `json:"variants,omitempty"`
+	DurationMs     int64             `json:"duration_ms,omitempty"`
+	Poster         string            `json:"poster,omitempty"`
+	PosterVariants map[string]string `json:"poster_variants,omitempty"`
+}
+
+type VideoResponse struct {
+	URL            string            `json:"url"`
+	MimeType       string            `json:"mime_type"`
+	DurationMs     int64             `json:"duration_ms"`
+	Width          int               `json:"width"`
+	Height         int               `json:"height"`
+	Poster         string            `json:"poster"`
+	PosterVariants map[string]string `json:"poster_variants"`
+}
+
+type StorageUsage struct {
+	Bytes int64 `json:"bytes"`
+	Files int64 `json:"files"`
+}
+
+type StorageUsageResponse struct {
+	Role            string       `json:"role"`
+	Used            StorageUsage `json:"used"`
+	Quota           StorageUsage `json:"quota"`
+	UploadsPerHour  int          `json:"uploads_per_hour"`
+	Tweets          StorageUsage `json:"tweets"`
+	ProfilePictures StorageUsage `json:"profile_pictures"`
+	PendingMedia    StorageUsage `json:"pending_media"`
 }
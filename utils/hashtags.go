@@ -0,0 +1,46 @@
+package utils
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+const maxHashtagLength = 100
+
+var hashtagRegex = regexp.MustCompile(`(?:^|[^\p{L}\p{N}_&/])#([\p{L}\p{N}_]+)`)
+
+// NormalizeHashtag lowercases a tag and strips a leading '#', so "#GoLang"
+// and "golang" end up in the same row.
+func NormalizeHashtag(tag string) string {
+	return strings.ToLower(strings.TrimPrefix(strings.TrimSpace(tag), "#"))
+}
+
+// ExtractHashtags returns the unique, normalized hashtags found in texts in
+// order of first appearance. Purely numeric tags such as "#1" are skipped.
+func ExtractHashtags(texts ...string) []string {
+	seen := make(map[string]bool)
+	var tags []string
+
+	for _, text := range texts {
+		for _, match := range hashtagRegex.FindAllStringSubmatch(text, -1) {
+			tag := NormalizeHashtag(match[1])
+			if tag == "" || len(tag) > maxHashtagLength || isNumeric(tag) || seen[tag] {
+				continue
+			}
+			seen[tag] = true
+			tags = append(tags, tag)
+		}
+	}
+
+	return tags
+}
+
+func isNumeric(s string) bool {
+	for _, char := range s {
+		if !unicode.IsDigit(char) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,30 @@
+package utils
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestExtractHashtags(t *testing.T) {
+	tests := []struct {
+		texts []string
+		want  []string
+	}{
+		{[]string{"#Go and #go"}, []string{"go"}},
+		{[]string{"(#rust), #Go!"}, []string{"rust", "go"}},
+		{[]string{"#café #日本語"}, []string{"café", "日本語"}},
+		// The title comes first, duplicates across texts are dropped.
+		{[]string{"#a title", "body #b #A"}, []string{"a", "b"}},
+		// Numbers, URL fragments and words containing # aren't tags.
+		{[]string{"#1 #2024"}, nil},
+		{[]string{"see http://example.com/#anchor"}, nil},
+		{[]string{"C#sharp AT&T#x"}, nil},
+		{[]string{"no tags"}, nil},
+	}
+
+	for _, test := range tests {
+		if got := ExtractHashtags(test.texts...); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("ExtractHashtags(%q) = %q, want %q", test.texts, got, test.want)
+		}
+	}
+}
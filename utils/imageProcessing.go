@@ -0,0 +1,223 @@
+package utils
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	_ "golang.org/x/image/webp"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"net/http"
+)
+
+const (
+	MaxImageSize      = 20 << 20
+	MaxImageDimension = 8192
+	MaxImagePixels    = 40_000_000
+	// MaxAnimationPixels bounds the pixels of all the frames of a GIF
+	// together, each of them is decoded in memory.
+	MaxAnimationPixels = 200_000_000
+	jpegQuality        = 90
+)
+
+var (
+	ErrUnsupportedImage  = errors.New("only JPEG, PNG, GIF and WebP images are allowed")
+	ErrInvalidImage      = errors.New("file is not a valid image")
+	ErrImageTooLarge     = fmt.Errorf("image must be at most %dx%d pixels", MaxImageDimension, MaxImageDimension)
+	ErrImageFileTooLarge = fmt.Errorf("image must be at most %d MB", MaxImageSize>>20)
+	ErrAnimationTooLarge = errors.New("animation has too many frames for its size")
+)
+
+var allowedImageTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+	"image/webp": true,
+}
+
+type ProcessedImage struct {
+	Data     []byte
+	MimeType string
+	Ext      string
+	Width    int
+	Height   int
+	// Image is the decoded picture, the first frame for animated GIFs.
+	Image image.Image
+}
+
+// ProcessImage checks that data really is an allowed image and re-encodes it
+// so EXIF and any other metadata is dropped, after turning JPEG photos
+// upright. The dimensions, and the frame count of GIFs, are checked before
+// decoding to avoid decompression bombs. WebP has no encoder in the standard
+// library and is re-encoded as PNG.
+func ProcessImage(r io.Reader) (*ProcessedImage, error) {
+	data, err := io.ReadAll(io.LimitReader(r, MaxImageSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > MaxImageSize {
+		return nil, ErrImageFileTooLarge
+	}
+
+	mimeType := http.DetectContentType(data)
+	if !allowedImageTypes[mimeType] {
+		return nil, ErrUnsupportedImage
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrInvalidImage
+	}
+	if config.Width > MaxImageDimension || config.Height > MaxImageDimension ||
+		config.Width*config.Height > MaxImagePixels {
+		return nil, ErrImageTooLarge
+	}
+
+	processed := &ProcessedImage{
+		Width:  config.Width,
+		Height: config.Height,
+	}
+
+	var out bytes.Buffer
+	switch mimeType {
+	case "image/gif":
+		frames, err := gifFrameCount(data)
+		if err != nil {
+			return nil, ErrInvalidImage
+		}
+		if frames*config.Width*config.Height > MaxAnimationPixels {
+			return nil, ErrAnimationTooLarge
+		}
+
+		// Decode every frame so animations survive the re-encode.
+		animation, err := gif.DecodeAll(bytes.NewReader(data))
+		if err != nil {
+			return nil, ErrInvalidImage
+		}
+		if err := gif.EncodeAll(&out, animation); err != nil {
+			return nil, err
+		}
+		processed.MimeType, processed.Ext = "image/gif", ".gif"
+		processed.Image = animation.Image[0]
+	case "image/jpeg":
+		img, _, err := image.Decode(bytes.NewReader(data))
+		if err != nil {
+			return nil, ErrInvalidImage
+		}
+		img = orient(img, jpegOrientation(data))
+		processed.Width, processed.Height = img.Bounds().Dx(), img.Bounds().Dy()
+		if err := jpeg.Encode(&out, img, &jpeg.Options{Quality: jpegQuality}); err != nil {
+			return nil, err
+		}
+		processed.MimeType, processed.Ext = "image/jpeg", ".jpg"
+		processed.Image = img
+	default:
+		img, _, err := image.Decode(bytes.NewReader(data))
+		if err != nil {
+			return nil, ErrInvalidImage
+		}
+		if err := png.Encode(&out, img); err != nil {
+			return nil, err
+		}
+		processed.MimeType, processed.Ext = "image/png", ".png"
+		processed.Image = img
+	}
+
+	processed.Data = out.Bytes()
+	return processed, nil
+}
+
+// gifFrameCount counts the frames of a GIF by walking its blocks, without
+// decompressing them.
+func gifFrameCount(data []byte) (int, error) {
+	// Header and logical screen descriptor, then the global color table.
+	if len(data) < 13 {
+		return 0, ErrInvalidImage
+	}
+	i := 13
+	if flags := data[10]; flags&0x80 != 0 {
+		i += 3 << (flags&0x07 + 1)
+	}
+
+	// skipSubBlocks returns the index past a sequence of data sub-blocks.
+	skipSubBlocks := func(i int) (int, error) {
+		for {
+			if i >= len(data) {
+				return 0, ErrInvalidImage
+			}
+			size := int(data[i])
+			i++
+			if size == 0 {
+				return i, nil
+			}
+			i += size
+		}
+	}
+
+	frames := 0
+	for {
+		if i >= len(data) {
+			return 0, ErrInvalidImage
+		}
+		var err error
+		switch data[i] {
+		case 0x21: // extension: label, then sub-blocks
+			i, err = skipSubBlocks(i + 2)
+		case 0x2C: // image descriptor, local color table, LZW code size
+			if i+10 > len(data) {
+				return 0, ErrInvalidImage
+			}
+			frames++
+			flags := data[i+9]
+			i += 10
+			if flags&0x80 != 0 {
+				i += 3 << (flags&0x07 + 1)
+			}
+			i, err = skipSubBlocks(i + 1)
+		case 0x3B: // trailer
+			return frames, nil
+		default:
+			return 0, ErrInvalidImage
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+}
+
+// EncodeImage encodes a single image in the given format.
+func EncodeImage(img image.Image, mimeType string) ([]byte, error) {
+	var out bytes.Buffer
+	var err error
+
+	switch mimeType {
+	case "image/gif":
+		err = gif.Encode(&out, img, nil)
+	case "image/jpeg":
+		err = jpeg.Encode(&out, img, &jpeg.Options{Quality: jpegQuality})
+	default:
+		err = png.Encode(&out, img)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return out.Bytes(), nil
+}
+
+// ImageErrorStatus maps a ProcessImage error to the HTTP status to reply with.
+func ImageErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrUnsupportedImage):
+		return http.StatusUnsupportedMediaType
+	case errors.Is(err, ErrImageFileTooLarge):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, ErrInvalidImage), errors.Is(err, ErrImageTooLarge), errors.Is(err, ErrAnimationTooLarge):
+		return http.StatusUnprocessableEntity
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,119 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/gif"
+	"image/jpeg"
+	"testing"
+)
+
+// exifJPEG returns a w×h JPEG whose EXIF data says it must be shown with
+// orientation. Its top left pixel is red and the rest black.
+func exifJPEG(t *testing.T, w, h int, orientation uint16) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.Black)
+		}
+	}
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			img.Set(x, y, color.RGBA{R: 255, A: 255})
+		}
+	}
+	var encoded bytes.Buffer
+	if err := jpeg.Encode(&encoded, img, &jpeg.Options{Quality: 100}); err != nil {
+		t.Fatal(err)
+	}
+
+	// A little endian TIFF header with one IFD holding the Orientation.
+	var tiff bytes.Buffer
+	tiff.WriteString("II")
+	binary.Write(&tiff, binary.LittleEndian, uint16(42))
+	binary.Write(&tiff, binary.LittleEndian, uint32(8))
+	binary.Write(&tiff, binary.LittleEndian, uint16(1))
+	binary.Write(&tiff, binary.LittleEndian, []uint16{0x0112, 3})
+	binary.Write(&tiff, binary.LittleEndian, uint32(1))
+	binary.Write(&tiff, binary.LittleEndian, []uint16{orientation, 0})
+	binary.Write(&tiff, binary.LittleEndian, uint32(0))
+
+	app1 := append([]byte("Exif\x00\x00"), tiff.Bytes()...)
+	var out bytes.Buffer
+	out.Write(encoded.Bytes()[:2])
+	out.Write([]byte{0xFF, 0xE1})
+	binary.Write(&out, binary.BigEndian, uint16(len(app1)+2))
+	out.Write(app1)
+	out.Write(encoded.Bytes()[2:])
+	return out.Bytes()
+}
+
+func TestProcessImageAppliesOrientation(t *testing.T) {
+	processed, err := ProcessImage(bytes.NewReader(exifJPEG(t, 64, 32, 6)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if processed.Width != 32 || processed.Height != 64 {
+		t.Fatalf("got %dx%d, want 32x64", processed.Width, processed.Height)
+	}
+	// Rotated clockwise, the top left corner ends up top right.
+	if r, _, _, _ := processed.Image.At(28, 4).RGBA(); r < 0xC000 {
+		t.Fatalf("top right pixel isn't red after rotating")
+	}
+	if r, _, _, _ := processed.Image.At(4, 4).RGBA(); r > 0x4000 {
+		t.Fatalf("top left pixel is still red after rotating")
+	}
+}
+
+func TestProcessImageRejectsLargeFiles(t *testing.T) {
+	data := exifJPEG(t, 8, 8, 1)
+	data = append(data, make([]byte, MaxImageSize)...)
+	_, err := ProcessImage(bytes.NewReader(data))
+	if !errors.Is(err, ErrImageFileTooLarge) {
+		t.Fatalf("got %v, want ErrImageFileTooLarge", err)
+	}
+}
+
+func TestProcessImageRejectsAnimationBombs(t *testing.T) {
+	const size = 4096
+	frames := MaxAnimationPixels/(size*size) + 1
+
+	// The frames are tiny to keep the test fast, but each of them could
+	// cover the whole animation, which is what is checked.
+	animation := &gif.GIF{Config: image.Config{Width: size, Height: size, ColorModel: color.Palette(palette.Plan9)}}
+	for i := 0; i < frames; i++ {
+		animation.Image = append(animation.Image, image.NewPaletted(image.Rect(0, 0, 1, 1), palette.Plan9))
+		animation.Delay = append(animation.Delay, 0)
+	}
+	var data bytes.Buffer
+	if err := gif.EncodeAll(&data, animation); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := ProcessImage(&data)
+	if !errors.Is(err, ErrAnimationTooLarge) {
+		t.Fatalf("got %v, want ErrAnimationTooLarge", err)
+	}
+}
+
+func TestGIFFrameCount(t *testing.T) {
+	animation := &gif.GIF{}
+	for i := 0; i < 3; i++ {
+		animation.Image = append(animation.Image, image.NewPaletted(image.Rect(0, 0, 4, 4), palette.Plan9))
+		animation.Delay = append(animation.Delay, 10)
+	}
+	var data bytes.Buffer
+	if err := gif.EncodeAll(&data, animation); err != nil {
+		t.Fatal(err)
+	}
+
+	frames, err := gifFrameCount(data.Bytes())
+	if err != nil || frames != 3 {
+		t.Fatalf("got %d frames, %v, want 3", frames, err)
+	}
+}
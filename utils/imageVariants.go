@@ -0,0 +1,72 @@
+package utils
+
+import (
+	"golang.org/x/image/draw"
+	"image"
+	"path"
+	"strings"
+)
+
+type ImageVariant struct {
+	Name string
+	Size int
+	// Square variants are center-cropped before resizing.
+	Square bool
+}
+
+var AvatarVariants = []ImageVariant{
+	{Name: "48", Size: 48, Square: true},
+	{Name: "96", Size: 96, Square: true},
+	{Name: "400", Size: 400, Square: true},
+}
+
+var TweetMediaVariants = []ImageVariant{
+	{Name: "small", Size: 340},
+	{Name: "medium", Size: 680},
+	{Name: "large", Size: 1200},
+}
+
+func FindImageVariant(name string) (ImageVariant, bool) {
+	for _, variants := range [][]ImageVariant{AvatarVariants, TweetMediaVariants} {
+		for _, variant := range variants {
+			if variant.Name == name {
+				return variant, true
+			}
+		}
+	}
+	return ImageVariant{}, false
+}
+
+// VariantPath returns the key of a variant of the image stored at key, e.g.
+// "tweets/a.jpg" becomes "tweets/a_small.jpg".
+func VariantPath(key, variant string) string {
+	ext := path.Ext(key)
+	return strings.TrimSuffix(key, ext) + "_" + variant + ext
+}
+
+// ResizeImage scales src down so that it fits in a Size x Size box. Images
+// that are already smaller are not scaled up.
+func ResizeImage(src image.Image, variant ImageVariant) image.Image {
+	srcRect := src.Bounds()
+	if variant.Square {
+		side := min(srcRect.Dx(), srcRect.Dy())
+		x := srcRect.Min.X + (srcRect.Dx()-side)/2
+		y := srcRect.Min.Y + (srcRect.Dy()-side)/2
+		srcRect = image.Rect(x, y, x+side, y+side)
+	}
+
+	width, height := srcRect.Dx(), srcRect.Dy()
+	if width > variant.Size || height > variant.Size {
+		if width >= height {
+			height = max(1, height*variant.Size/width)
+			width = variant.Size
+		} else {
+			width = max(1, width*variant.Size/height)
+			height = variant.Size
+		}
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, srcRect, draw.Over, nil)
+	return dst
+}
@@ -0,0 +1,33 @@
+package utils
+
+import (
+	"regexp"
+	"unicode/utf8"
+)
+
+var mentionRegex = regexp.MustCompile(`(?:^|[^\p{L}\p{N}_@])@([A-Za-z0-9_]+)`)
+
+type MentionMatch struct {
+	UserName string
+	Start    int
+	End      int
+}
+
+// ExtractMentions returns every @username in text. Start and End are
+// character (rune) offsets of the whole "@username" token, End exclusive.
+func ExtractMentions(text string) []MentionMatch {
+	var mentions []MentionMatch
+
+	for _, match := range mentionRegex.FindAllStringSubmatchIndex(text, -1) {
+		// match[2]:match[3] is the username, the '@' sits right before it.
+		atIndex := match[2] - 1
+		start := utf8.RuneCountInString(text[:atIndex])
+		mentions = append(mentions, MentionMatch{
+			UserName: text[match[2]:match[3]],
+			Start:    start,
+			End:      start + utf8.RuneCountInString(text[atIndex:match[3]]),
+		})
+	}
+
+	return mentions
+}
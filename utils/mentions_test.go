@@ -0,0 +1,30 @@
+package utils
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestExtractMentions(t *testing.T) {
+	tests := []struct {
+		text string
+		want []MentionMatch
+	}{
+		{"hi @alice!", []MentionMatch{{"alice", 3, 9}}},
+		{"(@carol), @user_name.", []MentionMatch{{"carol", 1, 7}, {"user_name", 10, 20}}},
+		{"@alice and @alice", []MentionMatch{{"alice", 0, 6}, {"alice", 11, 17}}},
+		// Offsets count characters, not bytes.
+		{"héllo @bob", []MentionMatch{{"bob", 6, 10}}},
+		{"👋@frank", []MentionMatch{{"frank", 1, 7}}},
+		// Email addresses and doubled @ aren't mentions.
+		{"write to bob@example.com", nil},
+		{"@@dave", nil},
+		{"no mentions here", nil},
+	}
+
+	for _, test := range tests {
+		if got := ExtractMentions(test.text); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("ExtractMentions(%q) = %v, want %v", test.text, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"main/config"
+	"net/http"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	MaxVideoDuration = 140 * time.Second
+	ffmpegTimeout    = 30 * time.Second
+)
+
+var (
+	ErrUnsupportedVideo = errors.New("only MP4 and WebM videos are allowed")
+	ErrInvalidVideo     = errors.New("file is not a valid video")
+	ErrVideoTooLarge    = fmt.Errorf("video must be at most %d MB", config.MaxVideoSize>>20)
+	ErrVideoTooLong     = fmt.Errorf("video must be at most %d seconds long", int(MaxVideoDuration.Seconds()))
+)
+
+// ErrFFmpegUnavailable is returned by ProbeVideo and ExtractPosterFrame when
+// ffprobe or ffmpeg isn't installed. Callers are expected to carry on without
+// the metadata.
+var ErrFFmpegUnavailable = errors.New("ffmpeg is not available")
+
+// mp4Brands are the ISO base media major brands accepted as MP4. QuickTime
+// ("qt  ") and other containers are rejected.
+var mp4Brands = map[string]bool{
+	"isom": true, "iso2": true, "iso4": true, "iso5": true, "iso6": true,
+	"mp41": true, "mp42": true, "avc1": true, "M4V ": true, "dash": true,
+}
+
+type VideoInfo struct {
+	Duration time.Duration
+	Width    int
+	Height   int
+}
+
+// SniffVideo looks at the first bytes of a file and returns its MIME type and
+// extension if it is an MP4 or WebM container.
+func SniffVideo(header []byte) (string, string, bool) {
+	// MP4: a box of any size whose type is "ftyp", followed by the brand.
+	if len(header) >= 12 && string(header[4:8]) == "ftyp" && mp4Brands[string(header[8:12])] {
+		return "video/mp4", ".mp4", true
+	}
+
+	// WebM: an EBML header whose DocType is "webm" (plain Matroska is not
+	// accepted).
+	if len(header) >= 4 && bytes.Equal(header[:4], []byte{0x1A, 0x45, 0xDF, 0xA3}) &&
+		bytes.Contains(header[:min(len(header), 64)], []byte("webm")) {
+		return "video/webm", ".webm", true
+	}
+
+	return "", "", false
+}
+
+// IsVideoHeader reports whether the sniffed content type is some kind of
+// video, allowed or not.
+func IsVideoHeader(header []byte) bool {
+	if _, _, ok := SniffVideo(header); ok {
+		return true
+	}
+	return strings.HasPrefix(http.DetectContentType(header), "video/")
+}
+
+// ProbeVideo reads the duration and dimensions of a video file with ffprobe.
+func ProbeVideo(ctx context.Context, path string) (*VideoInfo, error) {
+	ffprobe, err := exec.LookPath("ffprobe")
+	if err != nil {
+		return nil, ErrFFmpegUnavailable
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, ffmpegTimeout)
+	defer cancel()
+
+	output, err := exec.CommandContext(ctx, ffprobe,
+		"-v", "error",
+		"-print_format", "json",
+		"-show_format",
+		"-show_streams",
+		path,
+	).Output()
+	if err != nil {
+		return nil, ErrInvalidVideo
+	}
+
+	var probe struct {
+		Format struct {
+			Duration string `json:"duration"`
+		} `json:"format"`
+		Streams []struct {
+			CodecType string `json:"codec_type"`
+			Width     int    `json:"width"`
+			Height    int    `json:"height"`
+		} `json:"streams"`
+	}
+	if err := json.Unmarshal(output, &probe); err != nil {
+		return nil, ErrInvalidVideo
+	}
+
+	info := &VideoInfo{}
+	for _, stream := range probe.Streams {
+		if stream.CodecType == "video" {
+			info.Width = stream.Width
+			info.Height = stream.Height
+			break
+		}
+	}
+	if info.Width == 0 || info.Height == 0 {
+		return nil, ErrInvalidVideo
+	}
+
+	seconds, err := strconv.ParseFloat(probe.Format.Duration, 64)
+	if err != nil {
+		return nil, ErrInvalidVideo
+	}
+	info.Duration = time.Duration(seconds * float64(time.Second))
+
+	return info, nil
+}
+
+// ExtractPosterFrame grabs a JPEG frame one second into the video, or the
+// first frame of shorter videos, with ffmpeg.
+func ExtractPosterFrame(ctx context.Context, path string, duration time.Duration) ([]byte, error) {
+	ffmpeg, err := exec.LookPath("ffmpeg")
+	if err != nil {
+		return nil, ErrFFmpegUnavailable
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, ffmpegTimeout)
+	defer cancel()
+
+	offset := "1"
+	if duration <= time.Second {
+		offset = "0"
+	}
+
+	output, err := exec.CommandContext(ctx, ffmpeg,
+		"-v", "error",
+		"-ss", offset,
+		"-i", path,
+		"-frames:v", "1",
+		"-f", "image2",
+		"-c:v", "mjpeg",
+		"pipe:1",
+	).Output()
+	if err != nil {
+		return nil, err
+	}
+	if len(output) == 0 {
+		return nil, ErrInvalidVideo
+	}
+
+	return output, nil
+}
+
+// VideoErrorStatus maps a video validation error to the HTTP status to reply
+// with, or returns 0 if err isn't one.
+func VideoErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrUnsupportedVideo):
+		return http.StatusUnsupportedMediaType
+	case errors.Is(err, ErrVideoTooLarge):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, ErrInvalidVideo), errors.Is(err, ErrVideoTooLong):
+		return http.StatusUnprocessableEntity
+	default:
+		return 0
+	}
+}